@@ -9,23 +9,72 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"github.com/spf13/viper"
+	"os"
+	"runtime"
 	"time"
 )
 
 var (
 	createSnapshots *bool
+	gcSnapshots     *bool
+	exportSnapshots *string
+	importSnapshots *string
+	snapshots       *string
+	subcommand      []string
 )
 
 func setDefaultConfig() {
-	viper.SetDefault("loglevel", 1)
+	viper.SetDefault("loglevel", "info")
+	viper.SetDefault("logformat", FormatText)
 	viper.SetDefault("server.host", "127.0.0.1")
 	viper.SetDefault("server.port", 80)
+	viper.SetDefault("server.socket.mode", "0660")
+	viper.SetDefault("server.admin.port", 8081)
+	viper.SetDefault("server.admin.socket.mode", "0660")
 	viper.SetDefault("server.base_path", "/")
+	viper.SetDefault("server.trusted_proxies", []string{})
+	viper.SetDefault("server.versions.public", false)
+	viper.SetDefault("server.drain_timeout", 30*time.Second)
+	viper.SetDefault("server.keys_file", "")
+	viper.SetDefault("server.keys_hash", "sha256")
+	viper.SetDefault("server.keys_cache", time.Minute)
+	viper.SetDefault("server.keys_reload", 10*time.Second)
+	viper.SetDefault("server.signature.skew", 5*time.Minute)
+	viper.SetDefault("server.signature.nonce_cache", 100000)
+	viper.SetDefault("server.tls.client_auth", "optional")
+	viper.SetDefault("server.tls.require_api_key", false)
+	viper.SetDefault("server.tls.reload", 10*time.Second)
+	viper.SetDefault("storage.backend", "local")
 	viper.SetDefault("storage.data", "/tmp/maxima-data")
+	viper.SetDefault("storage.s3.secure", true)
+	viper.SetDefault("storage.s3.region", "us-east-1")
+	viper.SetDefault("storage.s3.revalidate", time.Minute)
 	viper.SetDefault("storage.workspace", "/tmp")
+	viper.SetDefault("storage.janitor.interval", 10*time.Minute)
+	viper.SetDefault("storage.janitor.max_age", time.Hour)
+	viper.SetDefault("maxima.workers", runtime.NumCPU())
+	viper.SetDefault("maxima.usage_interval", time.Minute)
+	viper.SetDefault("maxima.retention.interval", 0)
+	viper.SetDefault("tracing.exporter", "none")
+	viper.SetDefault("tracing.endpoint", "http://127.0.0.1:4318")
+	viper.SetDefault("tracing.file", "/tmp/maxima-pool-traces.json")
+	viper.SetDefault("tracing.sample_ratio", 1.0)
+	viper.SetDefault("tracing.service_name", "maxima-pool")
+	viper.SetDefault("health.interval", 30*time.Second)
+	viper.SetDefault("health.probe.input", "1+1;")
+	viper.SetDefault("health.probe.expected", `\b2\b`)
+	viper.SetDefault("health.probe.versions", 1)
+	viper.SetDefault("health.min_free_space", 100)
+	viper.SetDefault("health.max_queued", 0)
 	viper.SetDefault("job.command", "maxima")
+	viper.SetDefault("job.concurrency", 0)
 	viper.SetDefault("job.timeout", 30*time.Second)
+	viper.SetDefault("job.expose_request_id", false)
+	viper.SetDefault("job.priority_ageing", 10*time.Second)
+	viper.SetDefault("limits.persist", false)
+	viper.SetDefault("limits.persist_interval", time.Minute)
 }
 
 func loadConfig() error {
@@ -36,7 +85,16 @@ func loadConfig() error {
 
 	configPath := flag.String("config", "", "Path to config.yaml")
 	createSnapshots = flag.Bool("create-snapshots", false, "Create snapshots; must run before normal application mode")
+	gcSnapshots = flag.Bool("gc-snapshots", false, "Remove snapshots which are not retained by the retention policy")
+	exportSnapshots = flag.String("export-snapshots", "", "Export snapshots into the given bundle file")
+	importSnapshots = flag.String("import-snapshots", "", "Import snapshots from the given bundle file")
+	snapshots = flag.String("snapshots", "", "Comma-separated list of versions to export (default: all)")
+	flag.Usage = func() {
+		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [keys create|list|revoke|rotate ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
+	subcommand = flag.Args()
 	if *configPath != "" {
 		viper.SetConfigFile(*configPath)
 	} else {
@@ -9,14 +9,45 @@ package controller
 
 import (
 	"Moodle_Maxima_Pool/models"
+	"Moodle_Maxima_Pool/services"
+	"github.com/gin-gonic/gin"
 	"net/http"
 )
 
+// Keys of values in a request's context
+const (
+	ContextClient    = "client"
+	ContextClientIP  = "client_ip"
+	ContextIdentity  = "identity"
+	ContextJob       = "job"
+	ContextRequestID = "request_id"
+)
+
 var (
-	errRequestInvalid  = &models.ErrorResponseJSON{Status: http.StatusBadRequest, Code: "invalid_input", Title: "Invalid input", Details: "The request is invalid."}
-	errNotImplemented  = &models.ErrorResponseJSON{Status: http.StatusBadRequest, Code: "not_implemented", Title: "Not implemented", Details: "This action is not implemented."}
-	errLanguageMissing = &models.ErrorResponseJSON{Status: http.StatusBadRequest, Code: "language_not_found", Title: "Language not found", Details: "The requested language does not exist."}
-	errFileMissing     = &models.ErrorResponseJSON{Status: http.StatusNotFound, Code: "file_not_found", Title: "File not found", Details: "The requested file does not exist."}
-	errFileCreation    = &models.ErrorResponseJSON{Status: http.StatusBadRequest, Code: "file_creation", Title: "File not created", Details: "The sent file could not be created."}
-	errFileHash        = &models.ErrorResponseJSON{Status: http.StatusBadRequest, Code: "file_hash", Title: "File hash", Details: "The sent file hash does not equal to our hash calculation."}
+	errRequestInvalid   = &models.ErrorResponseJSON{Status: http.StatusBadRequest, Code: "invalid_input", Title: "Invalid input", Details: "The request is invalid."}
+	errNotImplemented   = &models.ErrorResponseJSON{Status: http.StatusBadRequest, Code: "not_implemented", Title: "Not implemented", Details: "This action is not implemented."}
+	errLanguageMissing  = &models.ErrorResponseJSON{Status: http.StatusBadRequest, Code: "language_not_found", Title: "Language not found", Details: "The requested language does not exist."}
+	errFileMissing      = &models.ErrorResponseJSON{Status: http.StatusNotFound, Code: "file_not_found", Title: "File not found", Details: "The requested file does not exist."}
+	errFileCreation     = &models.ErrorResponseJSON{Status: http.StatusBadRequest, Code: "file_creation", Title: "File not created", Details: "The sent file could not be created."}
+	errFileHash         = &models.ErrorResponseJSON{Status: http.StatusBadRequest, Code: "file_hash", Title: "File hash", Details: "The sent file hash does not equal to our hash calculation."}
+	errJobFailed        = &models.ErrorResponseJSON{Status: http.StatusRequestedRangeNotSatisfiable, Code: "job_failed", Title: "Job failed", Details: "The job could not be processed."}
+	errSnapshotMissing  = &models.ErrorResponseJSON{Status: http.StatusNotFound, Code: "snapshot_not_found", Title: "Snapshot not found", Details: "The requested snapshot does not exist."}
+	errSnapshotLast     = &models.ErrorResponseJSON{Status: http.StatusConflict, Code: "snapshot_last", Title: "Last snapshot", Details: "The last usable snapshot cannot be disabled or deleted."}
+	errSnapshotStorage  = &models.ErrorResponseJSON{Status: http.StatusInternalServerError, Code: "snapshot_storage", Title: "Snapshot storage", Details: "The storage of snapshots could not be updated."}
+	errRebuildRunning   = &models.ErrorResponseJSON{Status: http.StatusConflict, Code: "rebuild_running", Title: "Rebuild running", Details: "A rebuild of all snapshots is already running."}
+	errRebuildMissing   = &models.ErrorResponseJSON{Status: http.StatusNotFound, Code: "rebuild_not_found", Title: "Rebuild not found", Details: "No rebuild of snapshots was started yet."}
+	errVersionsMissing  = &models.ErrorResponseJSON{Status: http.StatusServiceUnavailable, Code: "versions_not_found", Title: "Versions not found", Details: "No snapshot is available to serve jobs."}
+	errJobKilled        = &models.ErrorResponseJSON{Status: http.StatusRequestedRangeNotSatisfiable, Code: "job_killed", Title: "Job killed", Details: "The job was terminated by an administrator."}
+	errJobMissing       = &models.ErrorResponseJSON{Status: http.StatusNotFound, Code: "job_not_found", Title: "Job not found", Details: "The requested job is not running."}
+	errVersionForbidden = &models.ErrorResponseJSON{Status: http.StatusForbidden, Code: "version_forbidden", Title: "Version forbidden", Details: "The client may not use the requested version."}
+	errRateLimited      = &models.ErrorResponseJSON{Status: http.StatusTooManyRequests, Code: "rate_limited", Title: "Rate limited", Details: "The client sent too many jobs, retry later."}
+	errQuotaExceeded    = &models.ErrorResponseJSON{Status: http.StatusTooManyRequests, Code: "quota_exceeded", Title: "Quota exceeded", Details: "The jobs of the client consumed their time quota, retry later."}
+	errDraining         = &models.ErrorResponseJSON{Status: http.StatusServiceUnavailable, Code: "draining", Title: "Draining", Details: "The server does not accept jobs because it is shutting down."}
 )
+
+// AbortWithError aborts the request with the given error and the request's ID
+func AbortWithError(c *gin.Context, err *models.ErrorResponseJSON) {
+	status, errors := services.Error(err)
+	errors.RequestID = c.GetString(ContextRequestID)
+	c.AbortWithStatusJSON(status, errors)
+}
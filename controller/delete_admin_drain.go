@@ -0,0 +1,20 @@
+/*******************************************************************************
+ * Controller: DELETE admin drain
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package controller
+
+import (
+	"Moodle_Maxima_Pool/services"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// DeleteAdminDrain accepts jobs again; jobs which were already killed are not restored
+func DeleteAdminDrain(c *gin.Context) {
+	services.DrainStop()
+	c.JSON(http.StatusOK, services.DrainState())
+}
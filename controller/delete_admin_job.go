@@ -0,0 +1,22 @@
+/*******************************************************************************
+ * Controller: DELETE admin job
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package controller
+
+import (
+	"Moodle_Maxima_Pool/services"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+func DeleteAdminJob(c *gin.Context) {
+	if err := services.JobKill(c.Param("id")); err != nil {
+		AbortWithError(c, errJobMissing)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
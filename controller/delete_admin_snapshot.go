@@ -0,0 +1,22 @@
+/*******************************************************************************
+ * Controller: DELETE admin snapshot
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package controller
+
+import (
+	"Moodle_Maxima_Pool/services"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+func DeleteAdminSnapshot(c *gin.Context) {
+	if err := services.MaximaSnapshotDelete(c.Param("version")); err != nil {
+		abortWithSnapshotError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,18 @@
+/*******************************************************************************
+ * Controller: GET admin drain
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package controller
+
+import (
+	"Moodle_Maxima_Pool/services"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+func GetAdminDrain(c *gin.Context) {
+	c.JSON(http.StatusOK, services.DrainState())
+}
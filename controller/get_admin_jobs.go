@@ -0,0 +1,18 @@
+/*******************************************************************************
+ * Controller: GET admin jobs
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package controller
+
+import (
+	"Moodle_Maxima_Pool/services"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+func GetAdminJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, services.JobList())
+}
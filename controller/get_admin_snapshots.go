@@ -0,0 +1,27 @@
+/*******************************************************************************
+ * Controller: GET admin snapshots
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package controller
+
+import (
+	"Moodle_Maxima_Pool/services"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+func GetAdminSnapshots(c *gin.Context) {
+	c.JSON(http.StatusOK, services.MaximaSnapshots())
+}
+
+func GetAdminSnapshotRebuild(c *gin.Context) {
+	state := services.MaximaSnapshotRebuildState()
+	if state == nil {
+		AbortWithError(c, errRebuildMissing)
+		return
+	}
+	c.JSON(http.StatusOK, state)
+}
@@ -8,6 +8,7 @@
 package controller
 
 import (
+	"Moodle_Maxima_Pool/services"
 	"github.com/gin-gonic/gin"
 	"net/http"
 )
@@ -15,3 +16,13 @@ import (
 func GetHealth(c *gin.Context) {
 	c.AbortWithStatus(http.StatusOK)
 }
+
+// GetHealthReady reports the result of all checks and fails unless all of them passed
+func GetHealthReady(c *gin.Context) {
+	resp := services.Health()
+	if resp.Ready() {
+		c.JSON(http.StatusOK, resp)
+	} else {
+		c.JSON(http.StatusServiceUnavailable, resp)
+	}
+}
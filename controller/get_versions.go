@@ -0,0 +1,34 @@
+/*******************************************************************************
+ * Controller: GET versions
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package controller
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"Moodle_Maxima_Pool/services"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"slices"
+)
+
+func GetVersions(c *gin.Context) {
+	resp, err := services.MaximaVersions()
+	if err != nil {
+		_ = c.Error(err)
+		AbortWithError(c, errVersionsMissing)
+		return
+	}
+
+	// Clients only see the versions they may use
+	if identity, ok := c.Get(ContextIdentity); ok {
+		client := identity.(*models.Client)
+		resp.Versions = slices.DeleteFunc(resp.Versions, func(item models.MaximaVersion) bool {
+			return !client.AllowsVersion(item.Version, item.Aliases)
+		})
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,23 @@
+/*******************************************************************************
+ * Controller: POST admin drain
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package controller
+
+import (
+	"Moodle_Maxima_Pool/services"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// PostAdminDrain stops the admission of jobs and drains the running ones in the background
+func PostAdminDrain(c *gin.Context) {
+	if !services.Draining() {
+		services.DrainStart()
+		go services.Drain()
+	}
+	c.JSON(http.StatusAccepted, services.DrainState())
+}
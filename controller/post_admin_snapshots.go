@@ -0,0 +1,73 @@
+/*******************************************************************************
+ * Controller: POST admin snapshots
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package controller
+
+import (
+	"Moodle_Maxima_Pool/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// PostAdminSnapshotRebuild starts a rebuild of all snapshots in the background and reports its progress to the
+// given functions
+func PostAdminSnapshotRebuild(progress func(services.MaximaSnapshotProgress), finished func(error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		state, err := services.MaximaSnapshotRebuildStart(progress, finished)
+		if err != nil {
+			AbortWithError(c, errRebuildRunning)
+			return
+		}
+		c.JSON(http.StatusAccepted, state)
+	}
+}
+
+func PostAdminSnapshotDisable(c *gin.Context) {
+	setSnapshotDisabled(c, true)
+}
+
+func PostAdminSnapshotEnable(c *gin.Context) {
+	setSnapshotDisabled(c, false)
+}
+
+func PostAdminSnapshotDeprecate(c *gin.Context) {
+	setSnapshotDeprecated(c, true)
+}
+
+func PostAdminSnapshotUndeprecate(c *gin.Context) {
+	setSnapshotDeprecated(c, false)
+}
+
+func setSnapshotDeprecated(c *gin.Context, deprecated bool) {
+	if err := services.MaximaSnapshotSetDeprecated(c.Param("version"), deprecated); err != nil {
+		abortWithSnapshotError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func setSnapshotDisabled(c *gin.Context, disabled bool) {
+	if err := services.MaximaSnapshotSetDisabled(c.Param("version"), disabled); err != nil {
+		abortWithSnapshotError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// abortWithSnapshotError maps errors of the snapshot administration to responses
+func abortWithSnapshotError(c *gin.Context, err error) {
+	_ = c.Error(err)
+	switch {
+	case errors.As(err, new(services.ErrSnapshotNotFound)):
+		AbortWithError(c, errSnapshotMissing)
+	case errors.As(err, new(services.ErrLastSnapshot)):
+		AbortWithError(c, errSnapshotLast)
+	default:
+		AbortWithError(c, errSnapshotStorage)
+	}
+}
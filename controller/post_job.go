@@ -10,8 +10,13 @@ package controller
 import (
 	"Moodle_Maxima_Pool/models"
 	"Moodle_Maxima_Pool/services"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"math"
 	"net/http"
+	"slices"
+	"strconv"
+	"time"
 )
 
 func PostJob(c *gin.Context) {
@@ -21,12 +26,46 @@ func PostJob(c *gin.Context) {
 	}
 
 	if err := c.ShouldBind(reqQuery); err != nil {
-		c.AbortWithStatusJSON(services.Error(errRequestInvalid))
+		AbortWithError(c, errRequestInvalid)
 		return
 	}
+	if reqQuery.Priority == "" {
+		reqQuery.Priority = c.GetHeader("X-Priority")
+		if reqQuery.Priority != "" && !slices.Contains(models.JobPriorities, reqQuery.Priority) {
+			AbortWithError(c, errRequestInvalid)
+			return
+		}
+	}
+	reqQuery.RequestID = c.GetString(ContextRequestID)
+	reqQuery.Client = c.GetString(ContextClient)
+	reqQuery.ClientIP = c.GetString(ContextClientIP)
+	if identity, ok := c.Get(ContextIdentity); ok {
+		reqQuery.Versions = identity.(*models.Client).Versions
+		reqQuery.SharedKey = identity.(*models.Client).SharedKey
+	}
+
+	resp, err := services.JobCreate(c.Request.Context(), reqQuery)
+	c.Set(ContextJob, resp)
 
-	if resp, err := services.JobCreate(reqQuery); err != nil {
-		c.JSON(http.StatusRequestedRangeNotSatisfiable, err)
+	var rateLimited services.ErrRateLimited
+	var quotaExceeded services.ErrQuotaExceeded
+	if errors.As(err, new(services.ErrDraining)) {
+		AbortWithError(c, errDraining)
+	} else if errors.As(err, &rateLimited) {
+		_ = c.Error(err)
+		abortWithRetry(c, rateLimited.RetryAfter, errRateLimited)
+	} else if errors.As(err, &quotaExceeded) {
+		_ = c.Error(err)
+		abortWithRetry(c, quotaExceeded.RetryAfter, errQuotaExceeded)
+	} else if errors.As(err, new(services.ErrVersionForbidden)) {
+		_ = c.Error(err)
+		AbortWithError(c, errVersionForbidden)
+	} else if errors.As(err, new(services.ErrJobKilled)) {
+		_ = c.Error(err)
+		AbortWithError(c, errJobKilled)
+	} else if err != nil {
+		_ = c.Error(err)
+		AbortWithError(c, errJobFailed)
 	} else if resp.IsZIP {
 		c.DataFromReader(http.StatusOK, int64(resp.Output.Len()), "application/zip", resp.Output, map[string]string{
 			"Content-Disposition": `attachment; filename="output.zip"`,
@@ -35,3 +74,9 @@ func PostJob(c *gin.Context) {
 		c.DataFromReader(http.StatusOK, int64(resp.Output.Len()), gin.MIMEPlain, resp.Output, nil)
 	}
 }
+
+// abortWithRetry aborts the request with the given error and tells the client when to retry in whole seconds
+func abortWithRetry(c *gin.Context, retryAfter time.Duration, err *models.ErrorResponseJSON) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	AbortWithError(c, err)
+}
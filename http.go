@@ -11,19 +11,47 @@ import (
 	"Moodle_Maxima_Pool/controller"
 	"Moodle_Maxima_Pool/models"
 	"Moodle_Maxima_Pool/services"
+	"bytes"
 	"context"
-	"encoding/base64"
-	"fmt"
+	"crypto/tls"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"net"
 	"net/http"
+	"net/http/pprof"
+	"net/netip"
 	"path"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
+)
+
+const (
+	contextLogger    = "logger"
+	trustedProxyUnix = "unix"
+	signatureMaxBody = 16 << 20
 )
 
 var (
 	router              *gin.Engine
+	adminRouter         *gin.Engine
+	trustedProxies      []netip.Prefix
+	trustedUnixProxy    bool
+	requestIDRegex      = regexp.MustCompile("^[A-Za-z0-9._-]{1,64}$")
+	metricHTTPRequests  = promauto.NewCounterVec(prometheus.CounterOpts{Namespace: "maxima_pool", Name: "http_requests_total", Help: "Number of HTTP requests by route, method and status code."}, []string{"route", "method", "status"})
 	errUnauthenticated  = &models.ErrorResponseJSON{Status: http.StatusUnauthorized, Code: "unauthorized", Title: "Unauthorized", Details: "The request misses a valid API key."}
+	errForbidden        = &models.ErrorResponseJSON{Status: http.StatusForbidden, Code: "forbidden", Title: "Forbidden", Details: "The client may not connect from this network."}
 	errUndefinedRequest = &models.ErrorResponseJSON{Status: http.StatusRequestedRangeNotSatisfiable, Code: "undefined_request", Title: "Undefined request", Details: "The type of request is undefined."}
 )
 
@@ -35,27 +63,119 @@ func initHTTPConfig() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
+	// Route GIN's debug messages through our logger
+	gin.DebugPrintFunc = func(format string, values ...any) {
+		logger.Debugf(strings.TrimSuffix(format, "\n"), values...)
+	}
+	gin.DebugPrintRouteFunc = func(httpMethod, absolutePath, handlerName string, _ int) {
+		logger.Debugf("route %s %s to %s", httpMethod, absolutePath, handlerName)
+	}
+
+	// Forwarded addresses are only accepted from trusted proxies
+	trustedProxies, trustedUnixProxy = nil, false
+	for _, proxy := range viper.GetStringSlice("server.trusted_proxies") {
+		if proxy == trustedProxyUnix {
+			trustedUnixProxy = true
+		} else if prefix, err := models.ParseNetwork(proxy); err != nil {
+			logger.Fatalf("invalid trusted proxy %s: %s", proxy, err)
+		} else {
+			trustedProxies = append(trustedProxies, prefix)
+		}
+	}
+
 	// Check API key length
 	if len(viper.GetString("server.api_key")) < 16 {
 		logger.Warn("API key is very short")
 	}
+	if adminKey := viper.GetString("server.admin.api_key"); adminKey != "" && len(adminKey) < 16 {
+		logger.Warn("admin API key is very short")
+	}
 }
 
-func initHTTPRoutes() {
-	router = gin.Default()
-
-	router.Use(gin.CustomRecovery(errorHandlerGin))
-
+// initHTTPRoutes creates the router of the public listener and, if separate, the router of the admin listener
+func initHTTPRoutes(separateAdmin bool) {
+	router = newRouter()
 	router.Use(globalHeader())
 
 	router.GET("/openapi.json", controller.GetOpenAPI)
 
-	router.GET("/health", controller.GetHealth)
-
-	authorized := router.Group(path.Clean(viper.GetString("server.base_path")), validateAPIKey())
+	authorized := router.Group(path.Clean(viper.GetString("server.base_path")), validateAPIKey(models.ClientScopeJob), validateNetwork())
 
 	// Job
 	authorized.POST("/MaximaPool", controller.PostJob)
+
+	// Versions
+	if viper.GetBool("server.versions.public") {
+		router.GET(path.Join(path.Clean(viper.GetString("server.base_path")), "/versions"), controller.GetVersions)
+	} else {
+		authorized.GET("/versions", controller.GetVersions)
+	}
+
+	// Health, metrics and administration are only served by the admin listener if it is configured
+	if separateAdmin {
+		adminRouter = newRouter()
+		initHTTPAdminRoutes(adminRouter)
+
+		debug := adminRouter.Group("/debug/pprof", validateAPIKey(models.ClientScopeAdmin), validateNetwork())
+		debug.GET("/", gin.WrapF(pprof.Index))
+		debug.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+		debug.GET("/profile", gin.WrapF(pprof.Profile))
+		debug.GET("/symbol", gin.WrapF(pprof.Symbol))
+		debug.POST("/symbol", gin.WrapF(pprof.Symbol))
+		debug.GET("/trace", gin.WrapF(pprof.Trace))
+		debug.GET("/:profile", gin.WrapF(pprof.Index))
+	} else {
+		adminRouter = nil
+		initHTTPAdminRoutes(router)
+	}
+}
+
+// newRouter creates an engine with the middlewares of all listeners
+func newRouter() *gin.Engine {
+	engine := gin.New()
+
+	// The address of the client is determined by clientIP
+	_ = engine.SetTrustedProxies(nil)
+
+	engine.Use(requestID())
+
+	engine.Use(clientIP())
+
+	engine.Use(traceRequest())
+
+	engine.Use(accessLog())
+
+	engine.Use(gin.CustomRecovery(errorHandlerGin))
+
+	engine.Use(metricsHandler())
+
+	return engine
+}
+
+func initHTTPAdminRoutes(engine *gin.Engine) {
+	engine.GET("/health", controller.GetHealth)
+
+	engine.GET("/health/live", controller.GetHealth)
+
+	engine.GET("/health/ready", controller.GetHealthReady)
+
+	engine.GET("/metrics", validateAPIKey(models.ClientScopeMetrics), validateNetwork(), gin.WrapH(promhttp.Handler()))
+
+	// Administration is only accessible by clients with its scope
+	admin := engine.Group("/admin", validateAPIKey(models.ClientScopeAdmin), validateNetwork())
+	admin.GET("/snapshots", controller.GetAdminSnapshots)
+	admin.GET("/snapshots/rebuild", controller.GetAdminSnapshotRebuild)
+	admin.POST("/snapshots/rebuild", controller.PostAdminSnapshotRebuild(logSnapshotProgress, logSnapshotRebuild))
+	admin.POST("/snapshots/:version/disable", controller.PostAdminSnapshotDisable)
+	admin.POST("/snapshots/:version/enable", controller.PostAdminSnapshotEnable)
+	admin.POST("/snapshots/:version/deprecate", controller.PostAdminSnapshotDeprecate)
+	admin.POST("/snapshots/:version/undeprecate", controller.PostAdminSnapshotUndeprecate)
+	admin.DELETE("/snapshots/:version", controller.DeleteAdminSnapshot)
+	admin.GET("/jobs", controller.GetAdminJobs)
+	admin.DELETE("/jobs/:id", controller.DeleteAdminJob)
+	admin.GET("/drain", controller.GetAdminDrain)
+	admin.POST("/drain", controller.PostAdminDrain)
+	admin.DELETE("/drain", controller.DeleteAdminDrain)
 }
 
 func startHTTPServer() {
@@ -65,49 +185,208 @@ func startHTTPServer() {
 	logger.Debug("configure web server")
 	initHTTPConfig()
 
+	logger.Debug("create web server")
+	var tlsConfig *tls.Config
+	if tlsEnabled() {
+		var err error
+		if tlsConfig, err = newTLSConfig(); err != nil {
+			logger.Fatal(err)
+		}
+		startTLSReload()
+	}
+
+	publicListener, adminListener, err := openListeners()
+	if err != nil {
+		logger.Fatal(err)
+	}
+
 	logger.Debug("create routes")
-	initHTTPRoutes()
+	initHTTPRoutes(adminListener != nil)
 
-	logger.Debug("create web server")
-	server := &http.Server{Addr: fmt.Sprintf("%s:%d", viper.GetString("server.listen"), viper.GetInt("server.port")), Handler: router}
+	servers := []*http.Server{serve("web server", router, publicListener, tlsConfig)}
+	if adminListener != nil {
+		servers = append(servers, serve("admin server", adminRouter, adminListener, tlsConfig))
+	}
+	startSystemdNotify()
+
+	<-terminator
+
+	// Keep serving health and rejecting jobs until the running ones are finished or killed
+	logger.Infof("drain jobs for up to %s", viper.GetDuration("server.drain_timeout"))
+	services.DrainStart()
+	logSystemdNotify(systemdNotify("STOPPING=1", systemdStatus()))
+	services.Drain()
+
+	ctx, cancel := context.WithTimeout(context.Background(), ctxTimeout)
+	defer cancel()
+
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Warn(err)
+		}
+	}
+}
+
+// serve runs a server of the handler on the listener until it is shut down
+func serve(name string, handler http.Handler, listener *serverListener, tlsConfig *tls.Config) *http.Server {
+	server := &http.Server{Handler: handler, TLSConfig: tlsConfig}
+
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
 
 	go func() {
-		logger.Infof("start web server and listen to http://%s:%d", viper.GetString("server.listen"), viper.GetInt("server.port"))
-		if err := server.ListenAndServe(); err == http.ErrServerClosed {
+		logger.Infof("start %s and listen to %s://%s", name, scheme, listener.address)
+		var err error
+		if tlsConfig != nil {
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			err = server.Serve(listener)
+		}
+		if err == http.ErrServerClosed {
 			logger.Info(err)
 		} else {
 			logger.Fatal(err)
 		}
 	}()
+	return server
+}
 
-	<-terminator
+// validateAPIKey authenticates a client with the scope by a signed request, by API key via header or HTTP Basic Auth,
+// whose username is the client's name, or by the subject of its verified TLS certificate; `server.tls.require_api_key`
+// demands both of the same client
+func validateAPIKey(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, span := services.Tracer().Start(c.Request.Context(), "auth.validate", trace.WithAttributes(attribute.String("auth.scope", scope)))
+		defer func() {
+			span.SetAttributes(attribute.Bool("auth.valid", !c.IsAborted()), attribute.String("auth.client", c.GetString(controller.ContextClient)))
+			span.End()
+		}()
 
-	ctx, cancel := context.WithTimeout(context.Background(), ctxTimeout)
-	defer cancel()
+		if services.ClientScopeOpen(scope) {
+			return
+		}
 
-	if err := server.Shutdown(ctx); err != nil {
-		logger.Warn(err)
+		var client *models.Client
+		var ok bool
+		if signature := c.Request.Header.Get("X-Signature"); signature != "" {
+			client, ok = validateSignature(c, signature, scope)
+		} else if key := c.Request.Header.Get("X-API-Key"); key != "" {
+			client, ok = services.ClientAuthenticate("", key, scope)
+		} else if name, key, hasBasicAuth := c.Request.BasicAuth(); hasBasicAuth {
+			client, ok = services.ClientAuthenticate(name, key, scope)
+		}
+		var certClient *models.Client
+		var certOK bool
+		if c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) > 0 {
+			certClient, certOK = services.ClientAuthenticateCertificate(c.Request.TLS.VerifiedChains[0][0], scope)
+		}
+		if tlsEnabled() && viper.GetBool("server.tls.require_api_key") {
+			ok = ok && certOK && client.Name == certClient.Name
+		} else if !ok {
+			client, ok = certClient, certOK
+		}
+		if ok {
+			c.Set(controller.ContextClient, client.Name)
+			c.Set(controller.ContextIdentity, client)
+			return
+		}
+
+		c.Header("WWW-Authenticate", `Basic realm="restricted", charset="UTF-8"`)
+		controller.AbortWithError(c, errUnauthenticated)
 	}
 }
 
-func validateAPIKey() gin.HandlerFunc {
+// validateSignature verifies the signature of the request and its body of up to 16 MiB; the body stays readable for the
+// handlers
+func validateSignature(c *gin.Context, signature string, scope string) (*models.Client, bool) {
+	client, err := services.ClientAuthenticateSignature(services.ClientSignature{
+		Client:    c.Request.Header.Get("X-Client"),
+		Timestamp: c.Request.Header.Get("X-Timestamp"),
+		Nonce:     c.Request.Header.Get("X-Nonce"),
+		Signature: signature,
+		Method:    c.Request.Method,
+		URI:       c.Request.URL.RequestURI(),
+		Body: func() ([]byte, error) {
+			if c.Request.Body == nil {
+				return nil, nil
+			}
+			body, err := io.ReadAll(io.LimitReader(c.Request.Body, signatureMaxBody+1))
+			if err != nil {
+				return nil, err
+			}
+			if len(body) > signatureMaxBody {
+				return nil, services.ErrSignatureInvalid{}
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+			return body, nil
+		},
+	}, scope, time.Now())
+	if err != nil {
+		_ = c.Error(err)
+		return nil, false
+	}
+	return client, true
+}
+
+// validateNetwork rejects authenticated clients which connect from outside of their networks
+func validateNetwork() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if c.Request.Header.Get("X-API-Key") == viper.GetString("server.api_key") {
-			return
+		if identity, ok := c.Get(controller.ContextIdentity); ok && !identity.(*models.Client).AllowsAddress(c.GetString(controller.ContextClientIP)) {
+			controller.AbortWithError(c, errForbidden)
 		}
+	}
+}
 
-		basicAuthHeader := strings.SplitN(c.Request.Header.Get("Authorization"), " ", 2)
-		if len(basicAuthHeader) == 2 && strings.EqualFold(basicAuthHeader[0], "Basic") {
-			if basicAuthPayload, err := base64.StdEncoding.DecodeString(basicAuthHeader[1]); err == nil {
-				if basicAuthPair := strings.SplitN(string(basicAuthPayload), ":", 2); len(basicAuthPair) == 2 && basicAuthPair[1] == viper.GetString("server.api_key") {
-					return
-				}
-			}
+// clientIP determines the address of the client: the peer of the connection or, if the peer is a trusted proxy, the
+// last address of `X-Forwarded-For` which is not a trusted proxy. The address of clients via Unix domain socket is
+// empty unless forwarded.
+func clientIP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(controller.ContextClientIP, realClientIP(c.Request))
+	}
+}
+
+func realClientIP(request *http.Request) string {
+	host, _, _ := net.SplitHostPort(request.RemoteAddr)
+	peer, err := netip.ParseAddr(host)
+	if err == nil {
+		peer = peer.Unmap()
+		if !proxyTrusted(peer) {
+			return peer.String()
 		}
+	} else if !trustedUnixProxy {
+		return ""
+	}
 
-		c.Header("WWW-Authenticate", `Basic realm="restricted", charset="UTF-8"`)
-		c.AbortWithStatusJSON(services.Error(errUnauthenticated))
+	var hops []string
+	for _, header := range request.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, errHop := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if errHop != nil {
+			break
+		}
+		if hop = hop.Unmap(); i == 0 || !proxyTrusted(hop) {
+			return hop.String()
+		}
 	}
+
+	if peer.IsValid() {
+		return peer.String()
+	}
+	return ""
+}
+
+func proxyTrusted(addr netip.Addr) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
 }
 
 func globalHeader() gin.HandlerFunc {
@@ -116,7 +395,96 @@ func globalHeader() gin.HandlerFunc {
 	}
 }
 
+func metricsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metricHTTPRequests.WithLabelValues(route, c.Request.Method, strconv.Itoa(c.Writer.Status())).Inc()
+	}
+}
+
+// requestID accepts the client's `X-Request-ID` or generates a new one and echoes it in the response
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if !requestIDRegex.MatchString(id) {
+			id = services.RequestIDCreate()
+		}
+
+		c.Set(controller.ContextRequestID, id)
+		c.Header("X-Request-ID", id)
+	}
+}
+
+// traceRequest spans the whole request and continues the trace of an upstream `traceparent` header
+func traceRequest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Request.Method
+		if route := c.FullPath(); route != "" {
+			name += " " + route
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := services.Tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(c.Request.Method),
+			semconv.HTTPRoute(c.FullPath()),
+			semconv.URLPath(c.Request.URL.Path),
+			attribute.String("request_id", c.GetString(controller.ContextRequestID)),
+		))
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(c.Writer.Status()))
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(c.Writer.Status()))
+		}
+	}
+}
+
+// accessLog provides a request logger and logs each request with the job's details
+func accessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Set(contextLogger, logger.With("request_id", c.GetString(controller.ContextRequestID), "client_ip", c.GetString(controller.ContextClientIP)))
+
+		c.Next()
+
+		fields := []any{
+			"status", c.Writer.Status(),
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"latency", time.Since(start),
+		}
+		if client := c.GetString(controller.ContextClient); client != "" {
+			fields = append(fields, "client", client)
+		}
+		if err := c.Errors.Last(); err != nil {
+			fields = append(fields, "error", err.Err)
+		}
+		if job, ok := c.Get(controller.ContextJob); ok {
+			resp := job.(*models.JobResponse)
+			fields = append(fields, "version", resp.Version, "priority", resp.Priority, "job_duration", resp.Duration, "job_cpu_time", resp.CPUTime, "outcome", resp.Outcome)
+		}
+
+		requestLogger(c).With(fields...).Infof("%s %s", c.Request.Method, c.Request.URL.Path)
+	}
+}
+
+// requestLogger returns the logger of the request
+func requestLogger(c *gin.Context) *Logger {
+	if requestLogger, ok := c.Value(contextLogger).(*Logger); ok {
+		return requestLogger
+	}
+	return logger
+}
+
 func errorHandlerGin(c *gin.Context, err any) {
-	logger.Warn(err)
-	c.AbortWithStatusJSON(services.Error(errUndefinedRequest))
+	requestLogger(c).Warn(err)
+	controller.AbortWithError(c, errUndefinedRequest)
 }
@@ -0,0 +1,321 @@
+/*******************************************************************************
+ * Test: HTTP
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package main
+
+import (
+	"Moodle_Maxima_Pool/controller"
+	"Moodle_Maxima_Pool/models"
+	"Moodle_Maxima_Pool/services"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_requestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"client id", "abc-123.X_y", "abc-123.X_y"},
+		{"generated id", "", ""},
+		{"invalid id", "abc 123\n", ""},
+		{"too long id", string(make([]byte, 65)), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotContext string
+			engine := gin.New()
+			engine.Use(requestID())
+			engine.GET("/", func(c *gin.Context) {
+				gotContext = c.GetString(controller.ContextRequestID)
+			})
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				request.Header.Set("X-Request-ID", tt.header)
+			}
+			engine.ServeHTTP(recorder, request)
+
+			got := recorder.Header().Get("X-Request-ID")
+			assert.Equal(t, gotContext, got)
+			if tt.want != "" {
+				assert.Equal(t, tt.want, got)
+			} else {
+				assert.Regexp(t, "^[0-9a-f]{32}$", got)
+			}
+		})
+	}
+}
+
+func Test_traceRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var got trace.SpanContext
+	engine := gin.New()
+	engine.Use(traceRequest())
+	engine.GET("/", func(c *gin.Context) {
+		got = trace.SpanContextFromContext(c.Request.Context())
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	engine.ServeHTTP(httptest.NewRecorder(), request)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", got.TraceID().String())
+	assert.True(t, got.IsSampled())
+}
+
+func Test_validateAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	viper.Set("server.api_key", "secretsecretsecret")
+	defer func() {
+		viper.Set("server.api_key", nil)
+		_ = services.ClientLoad()
+	}()
+	require.NoError(t, services.ClientLoad())
+
+	tests := []struct {
+		name       string
+		scope      string
+		header     string
+		username   string
+		password   string
+		wantStatus int
+		wantClient string
+	}{
+		{"api key", models.ClientScopeJob, "secretsecretsecret", "", "", http.StatusOK, ""},
+		{"basic auth", models.ClientScopeJob, "", "moodle", "secretsecretsecret", http.StatusOK, "moodle"},
+		{"wrong key", models.ClientScopeJob, "secretsecretsecreT", "", "", http.StatusUnauthorized, ""},
+		{"missing key", models.ClientScopeJob, "", "", "", http.StatusUnauthorized, ""},
+		{"open scope", models.ClientScopeMetrics, "", "", "", http.StatusOK, ""},
+		{"closed administration", models.ClientScopeAdmin, "secretsecretsecret", "", "", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotClient string
+			engine := gin.New()
+			engine.GET("/", validateAPIKey(tt.scope), func(c *gin.Context) {
+				gotClient = c.GetString(controller.ContextClient)
+			})
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				request.Header.Set("X-API-Key", tt.header)
+			}
+			if tt.password != "" {
+				request.SetBasicAuth(tt.username, tt.password)
+			}
+			engine.ServeHTTP(recorder, request)
+
+			assert.Equal(t, tt.wantStatus, recorder.Code)
+			assert.Equal(t, tt.wantClient, gotClient)
+		})
+	}
+}
+
+func Test_initHTTPRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	viper.Set("server.base_path", "/MaximaPool")
+	defer func() {
+		viper.Set("server.base_path", nil)
+		router, adminRouter = nil, nil
+	}()
+
+	paths := func(engine *gin.Engine) (paths []string) {
+		if engine == nil {
+			return
+		}
+		for _, route := range engine.Routes() {
+			paths = append(paths, route.Method+" "+route.Path)
+		}
+		return
+	}
+
+	initHTTPRoutes(false)
+	assert.Contains(t, paths(router), "POST /MaximaPool/MaximaPool")
+	assert.Contains(t, paths(router), "GET /health/ready")
+	assert.Contains(t, paths(router), "GET /admin/jobs")
+	assert.NotContains(t, paths(router), "GET /debug/pprof/")
+	assert.Nil(t, adminRouter)
+
+	initHTTPRoutes(true)
+	assert.Contains(t, paths(router), "GET /openapi.json")
+	assert.Contains(t, paths(router), "POST /MaximaPool/MaximaPool")
+	assert.NotContains(t, paths(router), "GET /health/ready")
+	assert.NotContains(t, paths(router), "GET /metrics")
+	assert.NotContains(t, paths(router), "GET /admin/jobs")
+	assert.Contains(t, paths(adminRouter), "GET /health/ready")
+	assert.Contains(t, paths(adminRouter), "GET /metrics")
+	assert.Contains(t, paths(adminRouter), "GET /admin/jobs")
+	assert.Contains(t, paths(adminRouter), "GET /debug/pprof/")
+	assert.NotContains(t, paths(adminRouter), "POST /MaximaPool/MaximaPool")
+}
+
+func Test_realClientIP(t *testing.T) {
+	defer func() {
+		trustedProxies, trustedUnixProxy = nil, false
+	}()
+
+	tests := []struct {
+		name       string
+		proxies    []string
+		unix       bool
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct", nil, false, "192.0.2.10:4711", nil, "192.0.2.10"},
+		{"untrusted proxy", nil, false, "192.0.2.10:4711", []string{"198.51.100.7"}, "192.0.2.10"},
+		{"trusted proxy", []string{"192.0.2.0/24"}, false, "192.0.2.10:4711", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"chain of proxies", []string{"192.0.2.0/24", "10.0.0.1"}, false, "192.0.2.10:4711", []string{"203.0.113.5, 198.51.100.7", "10.0.0.1"}, "198.51.100.7"},
+		{"only proxies", []string{"192.0.2.0/24"}, false, "192.0.2.10:4711", []string{"192.0.2.11"}, "192.0.2.11"},
+		{"invalid forwarded address", []string{"192.0.2.0/24"}, false, "192.0.2.10:4711", []string{"unknown"}, "192.0.2.10"},
+		{"mapped IPv4", []string{"192.0.2.10"}, false, "[::ffff:192.0.2.10]:4711", []string{"::ffff:198.51.100.7"}, "198.51.100.7"},
+		{"IPv6", nil, false, "[2001:db8::1]:4711", nil, "2001:db8::1"},
+		{"untrusted Unix domain socket", nil, false, "@", []string{"198.51.100.7"}, ""},
+		{"trusted Unix domain socket", nil, true, "@", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"trusted Unix domain socket without header", nil, true, "@", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trustedProxies, trustedUnixProxy = nil, tt.unix
+			for _, proxy := range tt.proxies {
+				prefix, err := models.ParseNetwork(proxy)
+				require.NoError(t, err)
+				trustedProxies = append(trustedProxies, prefix)
+			}
+
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.RemoteAddr = tt.remoteAddr
+			for _, forwarded := range tt.forwarded {
+				request.Header.Add("X-Forwarded-For", forwarded)
+			}
+			assert.Equal(t, tt.want, realClientIP(request))
+		})
+	}
+}
+
+func Test_validateNetwork(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		networks   []string
+		remoteAddr string
+		wantStatus int
+	}{
+		{"all networks", nil, "198.51.100.7:4711", http.StatusOK},
+		{"allowed network", []string{"10.0.0.0/8", "192.0.2.0/24"}, "192.0.2.10:4711", http.StatusOK},
+		{"allowed address", []string{"192.0.2.10"}, "192.0.2.10:4711", http.StatusOK},
+		{"forbidden network", []string{"10.0.0.0/8"}, "192.0.2.10:4711", http.StatusForbidden},
+		{"unknown address", []string{"10.0.0.0/8"}, "@", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := gin.New()
+			engine.Use(clientIP())
+			engine.GET("/", func(c *gin.Context) {
+				c.Set(controller.ContextIdentity, &models.Client{Name: "moodle", Networks: tt.networks})
+			}, validateNetwork(), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.RemoteAddr = tt.remoteAddr
+			engine.ServeHTTP(recorder, request)
+
+			assert.Equal(t, tt.wantStatus, recorder.Code)
+			if tt.wantStatus == http.StatusForbidden {
+				assert.Contains(t, recorder.Body.String(), `"code":"forbidden"`)
+			}
+		})
+	}
+}
+
+func Test_validateAPIKey_signature(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	secret := "0123456789abcdef0123456789abcdef"
+	keysFile := path.Join(t.TempDir(), "keys.yaml")
+	require.NoError(t, os.WriteFile(keysFile, []byte("clients: [{name: moodle, secret: "+secret+", scopes: [job]}]"), 0600))
+	viper.Set("server.keys_file", keysFile)
+	viper.Set("server.signature.skew", time.Minute)
+	viper.Set("server.signature.nonce_cache", 10)
+	defer func() {
+		viper.Set("server.keys_file", nil)
+		viper.Set("server.signature.skew", nil)
+		viper.Set("server.signature.nonce_cache", nil)
+		_ = services.ClientLoad()
+	}()
+	require.NoError(t, services.ClientLoad())
+
+	sign := func(method string, uri string, timestamp string, nonce string, body string) string {
+		bodySum := sha256.Sum256([]byte(body))
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(method + "\n" + uri + "\n" + timestamp + "\n" + nonce + "\n" + hex.EncodeToString(bodySum[:])))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	tests := []struct {
+		name       string
+		nonce      string
+		signedURI  string
+		signedBody string
+		wantStatus int
+	}{
+		{"valid", "0123456789abcdef", "/MaximaPool?debug=1", "input=1%2B1%3B", http.StatusOK},
+		{"replay", "0123456789abcdef", "/MaximaPool?debug=1", "input=1%2B1%3B", http.StatusUnauthorized},
+		{"other path", "0123456789abcdeg", "/admin/jobs", "input=1%2B1%3B", http.StatusUnauthorized},
+		{"other body", "0123456789abcdeh", "/MaximaPool?debug=1", "input=2%2B2%3B", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotInput string
+			engine := gin.New()
+			engine.POST("/MaximaPool", validateAPIKey(models.ClientScopeJob), func(c *gin.Context) {
+				gotInput = c.PostForm("input")
+			})
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, "/MaximaPool?debug=1", strings.NewReader("input=1%2B1%3B"))
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			request.Header.Set("X-Client", "moodle")
+			request.Header.Set("X-Timestamp", now)
+			request.Header.Set("X-Nonce", tt.nonce)
+			request.Header.Set("X-Signature", sign(http.MethodPost, tt.signedURI, now, tt.nonce, tt.signedBody))
+			engine.ServeHTTP(recorder, request)
+
+			assert.Equal(t, tt.wantStatus, recorder.Code)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, "1+1;", gotInput)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+/*******************************************************************************
+ * Subcommand: keys
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package main
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"Moodle_Maxima_Pool/services"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+var errKeysUsage = errors.New("usage: keys create <name> [--scopes job,admin,metrics] [--versions v1,v2] | keys list | keys revoke <name> | keys rotate <name>")
+
+// runKeysCommand manages the key store of `server.keys_file`; new keys are the only output, so they can be captured by
+// scripts, and they are only stored as hash
+func runKeysCommand(out io.Writer, args []string) error {
+	if len(args) == 0 {
+		return errKeysUsage
+	}
+
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("keys create", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		scopes := flags.String("scopes", models.ClientScopeJob, "Comma-separated list of scopes")
+		versions := flags.String("versions", "", "Comma-separated list of versions or tags the client may use (default: all)")
+
+		// Flags may follow the name
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() == 0 {
+			return errKeysUsage
+		}
+		name := flags.Arg(0)
+		if err := flags.Parse(flags.Args()[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() > 0 {
+			return errKeysUsage
+		}
+
+		key, err := services.ClientStoreCreate(name, splitList(*scopes), splitList(*versions))
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, key)
+		return err
+	case "list":
+		clients, err := services.ClientStoreList()
+		if err != nil {
+			return err
+		}
+		table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(table, "NAME\tSCOPES\tVERSIONS\tSTATUS")
+		for _, client := range clients {
+			status := "enabled"
+			if client.Disabled {
+				status = "revoked"
+			}
+			versions := strings.Join(client.Versions, ",")
+			if versions == "" {
+				versions = "*"
+			}
+			_, _ = fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", client.Name, strings.Join(client.Scopes, ","), versions, status)
+		}
+		return table.Flush()
+	case "revoke":
+		if len(args) != 2 {
+			return errKeysUsage
+		}
+		if err := services.ClientStoreRevoke(args[1]); err != nil {
+			return err
+		}
+		return nil
+	case "rotate":
+		if len(args) != 2 {
+			return errKeysUsage
+		}
+		key, err := services.ClientStoreRotate(args[1])
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, key)
+		return err
+	}
+	return errKeysUsage
+}
+
+func splitList(list string) (items []string) {
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return
+}
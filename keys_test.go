@@ -0,0 +1,54 @@
+/*******************************************************************************
+ * Test: Subcommand: keys
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package main
+
+import (
+	"bytes"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path"
+	"strings"
+	"testing"
+)
+
+func Test_runKeysCommand(t *testing.T) {
+	viper.Set("server.keys_file", path.Join(t.TempDir(), "keys.yaml"))
+	viper.Set("server.keys_hash", "sha256")
+	defer viper.Set("server.keys_file", nil)
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantErr    bool
+		wantOutput string
+	}{
+		{"create with flags after name", []string{"create", "moodle-a", "--scopes", "job,metrics", "--versions", "4.4.2, 4.5.0"}, false, "^moodle-a\\.[A-Za-z0-9_-]{43}\n$"},
+		{"create with flags before name", []string{"create", "--scopes=admin", "admin"}, false, "^admin\\.[A-Za-z0-9_-]{43}\n$"},
+		{"create without name", []string{"create", "--scopes", "job"}, true, ""},
+		{"create with unknown scope", []string{"create", "moodle-b", "--scopes", "root"}, true, ""},
+		{"rotate", []string{"rotate", "moodle-a"}, false, "^moodle-a\\.[A-Za-z0-9_-]{43}\n$"},
+		{"revoke", []string{"revoke", "admin"}, false, "^$"},
+		{"revoke unknown", []string{"revoke", "unknown"}, true, ""},
+		{"list", []string{"list"}, false, `^NAME +SCOPES +VERSIONS +STATUS\nmoodle-a +job,metrics +4.4.2,4.5.0 +enabled\nadmin +admin +\* +revoked\n$`},
+		{"unknown action", []string{"delete", "moodle-a"}, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			err := runKeysCommand(&output, tt.args)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Regexp(t, tt.wantOutput, output.String())
+			assert.False(t, strings.Contains(output.String(), "sha256:"))
+		})
+	}
+}
@@ -0,0 +1,157 @@
+/*******************************************************************************
+ * Listener of the HTTP server
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+const (
+	unixSocketPrefix   = "unix:"
+	systemdAdminFDName = "admin"
+)
+
+var errUnixSocketExists = errors.New("path of the Unix domain socket exists and is no socket")
+
+// serverListener is an opened listener and its address for logging
+type serverListener struct {
+	net.Listener
+	address string
+}
+
+// openListeners opens the public listener and the admin listener if `server.admin.listen` is set. Sockets of
+// systemd's socket activation take precedence: the one named `admin` (`FileDescriptorName=admin`) is the admin
+// listener, the first other one is the public listener.
+func openListeners() (public *serverListener, admin *serverListener, err error) {
+	activated, names, err := systemdListeners()
+	if err != nil {
+		return
+	}
+	for i, listener := range activated {
+		address := listener.Addr().String() + " (systemd)"
+		if names[i] == systemdAdminFDName && admin == nil {
+			admin = &serverListener{Listener: listener, address: address}
+		} else if names[i] != systemdAdminFDName && public == nil {
+			public = &serverListener{Listener: listener, address: address}
+		} else {
+			_ = listener.Close()
+		}
+	}
+	defer func() {
+		if err != nil {
+			for _, opened := range []*serverListener{public, admin} {
+				if opened != nil {
+					_ = opened.Close()
+				}
+			}
+		}
+	}()
+
+	if public == nil {
+		if public, err = listen("server"); err != nil {
+			return
+		}
+	}
+	if admin == nil && viper.GetString("server.admin.listen") != "" {
+		admin, err = listen("server.admin")
+	}
+	return
+}
+
+// listen opens a Unix domain socket if `<prefix>.listen` is `unix:<path>`, otherwise a TCP socket of `<prefix>.listen`
+// and `<prefix>.port`
+func listen(prefix string) (*serverListener, error) {
+	var listener net.Listener
+	var err error
+	address, isUnix := strings.CutPrefix(viper.GetString(prefix+".listen"), unixSocketPrefix)
+	if isUnix {
+		listener, err = listenUnix(address, prefix)
+		address = unixSocketPrefix + address
+	} else {
+		listener, err = net.Listen("tcp", fmt.Sprintf("%s:%d", address, viper.GetInt(prefix+".port")))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !isUnix {
+		address = listener.Addr().String()
+	}
+	return &serverListener{Listener: listener, address: address}, nil
+}
+
+// listenUnix creates the Unix domain socket with `<prefix>.socket.mode`, `<prefix>.socket.owner` and
+// `<prefix>.socket.group`; a socket left by a former process is replaced, the socket is removed when the listener is
+// closed
+func listenUnix(socketPath string, prefix string) (listener net.Listener, err error) {
+	if info, errStat := os.Lstat(socketPath); errStat == nil {
+		if info.Mode()&fs.ModeSocket == 0 {
+			return nil, errUnixSocketExists
+		}
+		if err = os.Remove(socketPath); err != nil {
+			return
+		}
+	}
+
+	if listener, err = net.Listen("unix", socketPath); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = listener.Close()
+		}
+	}()
+
+	mode, err := unixSocketMode(prefix)
+	if err != nil {
+		return
+	}
+	if err = os.Chmod(socketPath, mode); err != nil {
+		return
+	}
+
+	uid, gid := -1, -1
+	if owner := viper.GetString(prefix + ".socket.owner"); owner != "" {
+		var socketUser *user.User
+		if socketUser, err = user.Lookup(owner); err != nil {
+			return
+		}
+		if uid, err = strconv.Atoi(socketUser.Uid); err != nil {
+			return
+		}
+	}
+	if group := viper.GetString(prefix + ".socket.group"); group != "" {
+		var socketGroup *user.Group
+		if socketGroup, err = user.LookupGroup(group); err != nil {
+			return
+		}
+		if gid, err = strconv.Atoi(socketGroup.Gid); err != nil {
+			return
+		}
+	}
+	if uid >= 0 || gid >= 0 {
+		err = os.Chown(socketPath, uid, gid)
+	}
+	return
+}
+
+// unixSocketMode parses `<prefix>.socket.mode`, which is octal as string and already parsed as unquoted YAML number
+func unixSocketMode(prefix string) (fs.FileMode, error) {
+	if mode, ok := viper.Get(prefix + ".socket.mode").(int); ok {
+		return fs.FileMode(mode) & fs.ModePerm, nil
+	}
+	mode, err := strconv.ParseUint(viper.GetString(prefix+".socket.mode"), 8, 32)
+	return fs.FileMode(mode) & fs.ModePerm, err
+}
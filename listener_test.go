@@ -0,0 +1,96 @@
+/*******************************************************************************
+ * Test: listener
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package main
+
+import (
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"testing"
+)
+
+func Test_openListeners(t *testing.T) {
+	socketPath := path.Join(t.TempDir(), "pool.sock")
+	viper.Set("server.listen", unixSocketPrefix+socketPath)
+	viper.Set("server.socket.mode", "0600")
+	viper.Set("server.admin.listen", "127.0.0.1")
+	viper.Set("server.admin.port", 0)
+	defer func() {
+		for _, key := range []string{"server.listen", "server.socket.mode", "server.admin.listen", "server.admin.port"} {
+			viper.Set(key, nil)
+		}
+	}()
+
+	// The socket of a crashed process is replaced
+	stale, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+
+	listener, admin, err := openListeners()
+	require.NoError(t, err)
+	assert.Equal(t, "unix:"+socketPath, listener.address)
+	require.NotNil(t, admin)
+	assert.Regexp(t, `^127\.0\.0\.1:[1-9][0-9]*$`, admin.address)
+	require.NoError(t, admin.Close())
+
+	info, err := os.Stat(socketPath)
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0600), info.Mode().Perm())
+
+	conn, err := net.Dial("unix", socketPath)
+	require.NoError(t, err)
+	_ = conn.Close()
+
+	require.NoError(t, listener.Close())
+	assert.NoFileExists(t, socketPath)
+
+	// Without an admin listener, the public listener serves everything
+	viper.Set("server.admin.listen", nil)
+	listener, admin, err = openListeners()
+	require.NoError(t, err)
+	assert.Nil(t, admin)
+	require.NoError(t, listener.Close())
+}
+
+func Test_listenUnix_noSocket(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "pool.sock")
+	require.NoError(t, os.WriteFile(filePath, []byte("data"), 0600))
+
+	_, err := listenUnix(filePath, "server")
+	assert.Equal(t, errUnixSocketExists, err)
+	assert.FileExists(t, filePath)
+}
+
+func Test_unixSocketMode(t *testing.T) {
+	defer viper.Set("server.socket.mode", nil)
+
+	tests := []struct {
+		name    string
+		mode    any
+		want    fs.FileMode
+		wantErr bool
+	}{
+		{"string", "0660", 0660, false},
+		{"string without leading zero", "600", 0600, false},
+		{"number parsed by YAML", 0660, 0660, false},
+		{"invalid", "rw-rw----", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("server.socket.mode", tt.mode)
+			got, err := unixSocketMode("server")
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
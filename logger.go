@@ -8,9 +8,16 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
@@ -20,8 +27,29 @@ const (
 	Fatal
 )
 
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var levelNames = [4]string{"debug", "info", "warn", "fatal"}
+
+type ErrUnknownLevel string
+
+func (e ErrUnknownLevel) Error() string {
+	return "unknown log level " + string(e)
+}
+
+type ErrUnknownFormat string
+
+func (e ErrUnknownFormat) Error() string {
+	return "unknown log format " + string(e)
+}
+
 type Logger struct {
 	level      int
+	format     string
+	fields     []any
 	loggerList [4]*log.Logger
 }
 
@@ -33,9 +61,48 @@ func (l *Logger) SetLevel(level int) {
 	l.level = level
 }
 
+func (l *Logger) Format() string {
+	return l.format
+}
+
+// SetFormat switches between colourised text and one JSON object per line
+func (l *Logger) SetFormat(format string) error {
+	switch format {
+	case FormatText:
+		for level, prefix := range []string{"[\u001B[0;37mDEBUG\u001B[0m] ", "[\u001B[0;32mINFO\u001B[0m] ", "[\u001B[0;33mWARNING\u001B[0m] ", "[\u001B[0;31mFATAL\u001B[0m] "} {
+			l.loggerList[level].SetPrefix(prefix)
+			l.loggerList[level].SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+		}
+	case FormatJSON:
+		for level := range l.loggerList {
+			l.loggerList[level].SetPrefix("")
+			l.loggerList[level].SetFlags(0)
+		}
+	default:
+		return ErrUnknownFormat(format)
+	}
+
+	l.format = format
+	return nil
+}
+
+// ParseLevel accepts the name of a level as well as its number
+func ParseLevel(level string) (int, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(level, name) || level == strconv.Itoa(i) {
+			return i, nil
+		}
+	}
+	if strings.EqualFold(level, "warning") {
+		return Warn, nil
+	}
+	return Debug, ErrUnknownLevel(level)
+}
+
 func NewLogger() *Logger {
 	return &Logger{
-		level: Debug,
+		level:  Debug,
+		format: FormatText,
 		loggerList: [4]*log.Logger{
 			log.New(os.Stdout, "[\u001B[0;37mDEBUG\u001B[0m] ", log.Ldate|log.Ltime|log.Lshortfile),
 			log.New(os.Stdout, "[\u001B[0;32mINFO\u001B[0m] ", log.Ldate|log.Ltime|log.Lshortfile),
@@ -45,17 +112,33 @@ func NewLogger() *Logger {
 	}
 }
 
+// With returns a logger which adds the given key-value pairs to each message
+func (l *Logger) With(fields ...any) *Logger {
+	logger := *l
+	logger.fields = append(append([]any{}, l.fields...), fields...)
+	return &logger
+}
+
 func (l *Logger) logWithLevel(level int, format *string, v ...any) {
 	if l.level > level {
 		return
 	}
 
-	var err error
+	var (
+		err     error
+		message string
+	)
 
 	if format == nil {
-		err = l.loggerList[level].Output(3, fmt.Sprint(v...))
+		message = fmt.Sprint(v...)
 	} else {
-		err = l.loggerList[level].Output(3, fmt.Sprintf(*format, v...))
+		message = fmt.Sprintf(*format, v...)
+	}
+
+	if l.format == FormatJSON {
+		err = l.loggerList[level].Output(3, l.formatJSON(level, message))
+	} else {
+		err = l.loggerList[level].Output(3, message+l.formatFields())
 	}
 
 	if err != nil {
@@ -67,6 +150,57 @@ func (l *Logger) logWithLevel(level int, format *string, v ...any) {
 	}
 }
 
+func (l *Logger) formatFields() string {
+	var buf strings.Builder
+	for i := 0; i+1 < len(l.fields); i += 2 {
+		value := fmt.Sprint(l.fields[i+1])
+		if strings.ContainsAny(value, " \"=") || value == "" {
+			value = strconv.Quote(value)
+		}
+		buf.WriteString(fmt.Sprintf(" %v=%s", l.fields[i], value))
+	}
+	return buf.String()
+}
+
+func (l *Logger) formatJSON(level int, message string) string {
+	var buf bytes.Buffer
+	encode := func(key string, value any) {
+		if buf.Len() > 0 {
+			buf.WriteByte(',')
+		}
+		keyData, _ := json.Marshal(key)
+		buf.Write(keyData)
+		buf.WriteByte(':')
+
+		switch value := value.(type) {
+		case error:
+			valueData, _ := json.Marshal(value.Error())
+			buf.Write(valueData)
+		case time.Duration:
+			valueData, _ := json.Marshal(value.Seconds())
+			buf.Write(valueData)
+		default:
+			valueData, err := json.Marshal(value)
+			if err != nil {
+				valueData, _ = json.Marshal(fmt.Sprint(value))
+			}
+			buf.Write(valueData)
+		}
+	}
+
+	encode("time", time.Now().Format(time.RFC3339Nano))
+	encode("level", levelNames[level])
+	if _, file, line, ok := runtime.Caller(3); ok {
+		encode("caller", path.Base(file)+":"+strconv.Itoa(line))
+	}
+	encode("msg", message)
+	for i := 0; i+1 < len(l.fields); i += 2 {
+		encode(fmt.Sprint(l.fields[i]), l.fields[i+1])
+	}
+
+	return "{" + buf.String() + "}"
+}
+
 func (l *Logger) Debug(v ...any) {
 	l.logWithLevel(Debug, nil, v...)
 }
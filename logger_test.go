@@ -9,12 +9,15 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"github.com/stretchr/testify/assert"
 	"io"
 	"log"
 	"os"
 	"os/exec"
 	"testing"
+	"time"
 )
 
 func TestLogger_Print(t *testing.T) {
@@ -199,3 +202,102 @@ func TestLogger_logWithLevel(t *testing.T) {
 		})
 	}
 }
+
+func TestLogger_SetFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		wantErr bool
+	}{
+		{"text format", FormatText, false},
+		{"json format", FormatJSON, false},
+		{"unknown format", "xml", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLogger()
+			gotErr := l.SetFormat(tt.format)
+			assert.Equal(t, tt.wantErr, gotErr != nil)
+			if !tt.wantErr {
+				assert.Equal(t, tt.format, l.Format())
+			} else {
+				assert.Equal(t, FormatText, l.Format())
+			}
+		})
+	}
+}
+
+func TestLogger_With(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		fields []any
+		want   string
+	}{
+		{"text without fields", FormatText, nil, "[\x1b[0;32mINFO\x1b[0m] TEST\n"},
+		{"text with fields", FormatText, []any{"request_id", "abc", "version", "2023010400"}, "[\x1b[0;32mINFO\x1b[0m] TEST request_id=abc version=2023010400\n"},
+		{"text with quoted fields", FormatText, []any{"path", "/Maxima Pool", "client", ""}, "[\x1b[0;32mINFO\x1b[0m] TEST path=\"/Maxima Pool\" client=\"\"\n"},
+		{"json without fields", FormatJSON, nil, `{"level":"info","caller":"logger_test.go:0","msg":"TEST"}`},
+		{"json with fields", FormatJSON, []any{"request_id", "abc", "status", 200, "job_duration", 1500 * time.Millisecond}, `{"level":"info","caller":"logger_test.go:0","msg":"TEST","request_id":"abc","status":200,"job_duration":1.5}`},
+		{"json with error field", FormatJSON, []any{"error", errors.New("failed")}, `{"level":"info","caller":"logger_test.go:0","msg":"TEST","error":"failed"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := NewLogger()
+			assert.NoError(t, l.SetFormat(tt.format))
+			l.loggerList[Info].SetOutput(&buf)
+			l.loggerList[Info].SetFlags(0)
+
+			l.With(tt.fields...).Info("TEST")
+
+			if tt.format == FormatText {
+				assert.Equal(t, tt.want, buf.String())
+				return
+			}
+
+			// Time and line number vary
+			var got map[string]any
+			assert.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+			assert.NotEmpty(t, got["time"])
+			delete(got, "time")
+			assert.Regexp(t, `^logger_test\.go:[0-9]+$`, got["caller"])
+			got["caller"] = "logger_test.go:0"
+
+			var want map[string]any
+			assert.NoError(t, json.Unmarshal([]byte(tt.want), &want))
+			assert.Equal(t, want, got)
+		})
+	}
+
+	// Fields of the parent logger stay untouched
+	l := NewLogger().With("a", 1)
+	_ = l.With("b", 2)
+	assert.Equal(t, []any{"a", 1}, l.fields)
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		level   string
+		want    int
+		wantErr bool
+	}{
+		{"debug name", "debug", Debug, false},
+		{"info name", "INFO", Info, false},
+		{"warn name", "warn", Warn, false},
+		{"warning name", "warning", Warn, false},
+		{"fatal name", "fatal", Fatal, false},
+		{"info number", "1", Info, false},
+		{"fatal number", "3", Fatal, false},
+		{"unknown name", "trace", Debug, true},
+		{"unknown number", "4", Debug, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotErr := ParseLevel(tt.level)
+			assert.Equal(t, tt.wantErr, gotErr != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
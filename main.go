@@ -9,9 +9,12 @@ package main
 
 import (
 	"Moodle_Maxima_Pool/services"
+	"context"
+	"flag"
 	"github.com/spf13/viper"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -32,7 +35,7 @@ func init() {
 	go func() {
 
 		// Listen to interrupt and termination signals
-		termSignal := make(chan os.Signal)
+		termSignal := make(chan os.Signal, 1)
 		signal.Notify(termSignal, os.Interrupt, syscall.SIGTERM)
 		<-termSignal
 		close(terminator)
@@ -44,9 +47,11 @@ func init() {
 			waitGroup.Wait()
 		}()
 
+		// A second signal skips the drain of jobs
 		select {
 		case <-waitChannel:
-		case <-time.After(terminationTimeout):
+		case <-termSignal:
+		case <-time.After(viper.GetDuration("server.drain_timeout") + terminationTimeout):
 		}
 
 		os.Exit(143)
@@ -57,17 +62,142 @@ func main() {
 	if err := loadConfig(); err != nil {
 		logger.Fatal(err)
 	}
-	logger.SetLevel(viper.GetInt("loglevel"))
+	if level, err := ParseLevel(viper.GetString("loglevel")); err != nil {
+		logger.Fatal(err)
+	} else {
+		logger.SetLevel(level)
+	}
+	if err := logger.SetFormat(viper.GetString("logformat")); err != nil {
+		logger.Fatal(err)
+	}
+
+	// Subcommands do not need the storage of snapshots
+	if len(subcommand) > 0 {
+		if subcommand[0] != "keys" {
+			flag.Usage()
+			os.Exit(2)
+		}
+		if err := runKeysCommand(os.Stdout, subcommand[1:]); err != nil {
+			logger.Fatal(err)
+		}
+		return
+	}
+
+	if _, err := services.Storage(); err != nil {
+		logger.Fatal(err)
+	}
+
+	stopTracing := startTracing()
+	defer stopTracing()
 
 	if *createSnapshots {
-		err := services.MaximaSnapshotCreate()
-		if err != nil {
+		if err := services.MaximaSnapshotCreate(logSnapshotProgress); err != nil {
+			logger.Fatal(err)
+		}
+	} else if *gcSnapshots {
+		if err := collectSnapshots(); err != nil {
+			logger.Fatal(err)
+		}
+	} else if *exportSnapshots != "" {
+		if err := exportSnapshotBundle(*exportSnapshots, *snapshots); err != nil {
+			logger.Fatal(err)
+		}
+	} else if *importSnapshots != "" {
+		if err := importSnapshotBundle(*importSnapshots); err != nil {
 			logger.Fatal(err)
 		}
 	} else if _, err := services.MaximaSnapshotGet(""); err != nil {
 		logger.Fatal(err)
+	} else if err := services.ClientLoad(); err != nil {
+		logger.Fatal(err)
+	} else if err := services.ClientLimitsLoad(); err != nil {
+		logger.Fatal(err)
 	} else {
+		// Flush the spans of the last requests before the termination handler exits
+		waitGroup.Add(1)
+		startMaintenance()
 		startHTTPServer()
+		stopTracing()
+		waitGroup.Done()
 		waitGroup.Wait()
 	}
 }
+
+func logSnapshotProgress(progress services.MaximaSnapshotProgress) {
+	if progress.Err != nil {
+		logger.Warnf("[%d/%d] skip tag %s: %s", progress.Done, progress.Total, progress.Tag, progress.Err)
+	} else if progress.Validation != nil {
+		logger.Warnf("[%d/%d] build unhealthy snapshot %s from tag %s: %s", progress.Done, progress.Total, progress.Version, progress.Tag, progress.Validation)
+	} else {
+		logger.Infof("[%d/%d] build snapshot %s from tag %s", progress.Done, progress.Total, progress.Version, progress.Tag)
+	}
+}
+
+func logSnapshotRebuild(err error) {
+	if err != nil {
+		logger.Warnf("rebuild of snapshots failed: %s", err)
+	} else {
+		logger.Info("rebuild of snapshots finished")
+	}
+}
+
+// startTracing configures the export of spans and returns a function which flushes them once
+func startTracing() (stop func()) {
+	shutdown, err := services.TracingStart()
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), ctxTimeout)
+			defer cancel()
+			if err := shutdown(ctx); err != nil {
+				logger.Warn(err)
+			}
+		})
+	}
+}
+
+func exportSnapshotBundle(filePath string, versions string) (err error) {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return
+	}
+
+	var versionList []string
+	if versions != "" {
+		versionList = strings.Split(versions, ",")
+	}
+
+	exported, err := services.MaximaSnapshotExport(file, versionList)
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		_ = os.Remove(filePath)
+		return
+	}
+
+	logger.Infof("export snapshots %s into %s", strings.Join(exported, ", "), filePath)
+	return
+}
+
+func importSnapshotBundle(filePath string) (err error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	imported, err := services.MaximaSnapshotImport(file)
+	if err != nil {
+		return
+	}
+
+	logger.Infof("import snapshots %s from %s", strings.Join(imported, ", "), filePath)
+	return
+}
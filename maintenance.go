@@ -0,0 +1,110 @@
+/*******************************************************************************
+ * Periodic maintenance tasks
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package main
+
+import (
+	"Moodle_Maxima_Pool/services"
+	"github.com/spf13/viper"
+	"time"
+)
+
+func startMaintenance() {
+	runJanitor()
+	if interval := viper.GetDuration("storage.janitor.interval"); interval > 0 {
+		startPeriodicTask(interval, false, runJanitor)
+	}
+
+	if interval := viper.GetDuration("server.keys_reload"); interval > 0 {
+		startPeriodicTask(interval, false, reloadClients)
+	}
+
+	if interval := viper.GetDuration("health.interval"); interval > 0 {
+		go services.HealthProbe()
+		startPeriodicTask(interval, false, services.HealthProbe)
+	}
+
+	if interval := viper.GetDuration("maxima.usage_interval"); interval > 0 {
+		startPeriodicTask(interval, true, storeSnapshotUsage)
+	}
+
+	if interval := viper.GetDuration("limits.persist_interval"); interval > 0 && viper.GetBool("limits.persist") {
+		startPeriodicTask(interval, true, storeClientUsage)
+	}
+
+	if interval := viper.GetDuration("maxima.retention.interval"); interval > 0 {
+		startPeriodicTask(interval, false, func() {
+			if err := collectSnapshots(); err != nil {
+				logger.Warn(err)
+			}
+		})
+	}
+}
+
+// startPeriodicTask runs the task on every tick and optionally a last time on termination
+func startPeriodicTask(interval time.Duration, final bool, task func()) {
+	waitGroup.Add(1)
+	go func() {
+		defer waitGroup.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				task()
+			case <-terminator:
+				if final {
+					task()
+				}
+				return
+			}
+		}
+	}()
+}
+
+func storeSnapshotUsage() {
+	if err := services.MaximaSnapshotUsageStore(); err != nil {
+		logger.Warn(err)
+	}
+}
+
+func storeClientUsage() {
+	if err := services.ClientUsageStore(); err != nil {
+		logger.Warn(err)
+	}
+}
+
+func collectSnapshots() error {
+	removed, err := services.MaximaSnapshotGC()
+	for _, version := range removed {
+		logger.Infof("remove snapshot %s", version)
+	}
+	return err
+}
+
+func runJanitor() {
+	report, err := services.Janitor()
+	for _, pid := range report.Processes {
+		logger.Infof("kill orphaned snapshot process %d", pid)
+	}
+	for _, workspace := range report.Workspaces {
+		logger.Infof("remove stale workspace %s", workspace)
+	}
+	if err != nil {
+		logger.Warn(err)
+	}
+}
+
+func reloadClients() {
+	if reloaded, err := services.ClientStoreReload(); err != nil {
+		logger.Warnf("keep clients, reload of key store failed: %s", err)
+	} else if reloaded {
+		logger.Info("reload key store")
+	}
+}
@@ -0,0 +1,94 @@
+/*******************************************************************************
+ * Model: client
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package models
+
+import (
+	"net/netip"
+	"slices"
+)
+
+const (
+	ClientScopeJob     = "job"
+	ClientScopeAdmin   = "admin"
+	ClientScopeMetrics = "metrics"
+)
+
+// Client is an identity of the key store; its key is only stored as hash, its subject is either the common name or the
+// distinguished name of its TLS client certificate and its secret signs requests
+type Client struct {
+	Name     string   `mapstructure:"name" json:"name" yaml:"name"`
+	Key      string   `mapstructure:"key" json:"-" yaml:"key,omitempty"`
+	Subject  string   `mapstructure:"subject" json:"subject,omitempty" yaml:"subject,omitempty"`
+	Secret   string   `mapstructure:"secret" json:"-" yaml:"secret,omitempty"`
+	Scopes   []string `mapstructure:"scopes" json:"scopes" yaml:"scopes"`
+	Versions []string `mapstructure:"versions" json:"versions,omitempty" yaml:"versions,omitempty"`
+	Networks []string `mapstructure:"networks" json:"networks,omitempty" yaml:"networks,omitempty"`
+	Disabled bool     `mapstructure:"disabled" json:"disabled" yaml:"disabled,omitempty"`
+
+	// SharedKey marks a key without name, e.g. `server.api_key`, whose Name is the username chosen by the request
+	SharedKey bool `mapstructure:"-" json:"-" yaml:"-"`
+}
+
+// ClientStore is the content of the key store file
+type ClientStore struct {
+	Clients []Client `mapstructure:"clients" yaml:"clients"`
+}
+
+// HasScope checks whether the client may access endpoints of the scope
+func (c *Client) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// AllowsVersion checks whether the client may use a snapshot by its version or one of its tags; clients without a
+// list of versions may use all
+func (c *Client) AllowsVersion(version string, tags []string) bool {
+	if len(c.Versions) == 0 || slices.Contains(c.Versions, version) {
+		return true
+	}
+	for _, tag := range tags {
+		if slices.Contains(c.Versions, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAddress checks whether the client may connect from the address; clients without a list of networks may connect
+// from everywhere, unknown addresses are only allowed then
+func (c *Client) AllowsAddress(address string) bool {
+	if len(c.Networks) == 0 {
+		return true
+	}
+
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return false
+	}
+	for _, network := range c.Networks {
+		if prefix, err := ParseNetwork(network); err == nil && prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseNetwork parses a network in CIDR notation or a single address
+func ParseNetwork(network string) (netip.Prefix, error) {
+	if addr, err := netip.ParseAddr(network); err == nil {
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(network)
+	if err != nil {
+		return prefix, err
+	}
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+	return prefix.Masked(), nil
+}
@@ -0,0 +1,85 @@
+/*******************************************************************************
+ * Model: client limit
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package models
+
+import (
+	"encoding/gob"
+	"github.com/spf13/viper"
+	"os"
+	"path"
+	"time"
+)
+
+const ClientUsageFile = "client-usage.gob"
+
+// ClientLimits restrict the requests of a client; zero values are unlimited
+type ClientLimits struct {
+	Name        string      `mapstructure:"name"`
+	Rate        float64     `mapstructure:"rate"`
+	Burst       int         `mapstructure:"burst"`
+	WallTime    ClientQuota `mapstructure:"wall_time"`
+	CPUTime     ClientQuota `mapstructure:"cpu_time"`
+	Weight      float64     `mapstructure:"weight"`
+	MaxInFlight int         `mapstructure:"max_in_flight"`
+	Priority    string      `mapstructure:"priority"`
+	MaxPriority string      `mapstructure:"max_priority"`
+}
+
+type ClientQuota struct {
+	Hour time.Duration `mapstructure:"hour"`
+	Day  time.Duration `mapstructure:"day"`
+}
+
+// ClientUsage sums up the time consumed by jobs of a client in the current hour and day
+type ClientUsage struct {
+	Hour         time.Time
+	HourWallTime time.Duration
+	HourCPUTime  time.Duration
+	Day          time.Time
+	DayWallTime  time.Duration
+	DayCPUTime   time.Duration
+}
+
+// Reset starts new windows of the usage if now is beyond them
+func (u *ClientUsage) Reset(now time.Time) {
+	if hour := now.Truncate(time.Hour); !u.Hour.Equal(hour) {
+		u.Hour, u.HourWallTime, u.HourCPUTime = hour, 0, 0
+	}
+	if day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()); !u.Day.Equal(day) {
+		u.Day, u.DayWallTime, u.DayCPUTime = day, 0, 0
+	}
+}
+
+type ClientUsageMap map[string]ClientUsage
+
+// Store writes the usage to `storage.data`. Limits are enforced by each node on its own, so the usage is node-local
+// and not shared through the storage backend.
+func (m *ClientUsageMap) Store() (err error) {
+	file, err := os.Create(path.Join(viper.GetString("storage.data"), ClientUsageFile))
+	if err != nil {
+		return
+	}
+
+	err = gob.NewEncoder(file).Encode(m)
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	return
+}
+
+func (m *ClientUsageMap) Load() (err error) {
+	file, err := os.Open(path.Join(viper.GetString("storage.data"), ClientUsageFile))
+	if err != nil {
+		return
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	return gob.NewDecoder(file).Decode(m)
+}
@@ -0,0 +1,16 @@
+/*******************************************************************************
+ * Model: drain
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package models
+
+import "time"
+
+type DrainState struct {
+	Draining bool       `json:"draining"`
+	Since    *time.Time `json:"since,omitempty"`
+	Jobs     int        `json:"jobs"`
+}
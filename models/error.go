@@ -8,7 +8,8 @@
 package models
 
 type ErrorsResponseJSON struct {
-	Errors []*ErrorResponseJSON `json:"errors"`
+	Errors    []*ErrorResponseJSON `json:"errors"`
+	RequestID string               `json:"request_id,omitempty"`
 }
 
 type ErrorResponseJSON struct {
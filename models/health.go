@@ -0,0 +1,32 @@
+/*******************************************************************************
+ * Model: health
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package models
+
+import "time"
+
+const (
+	HealthStatusOK      = "ok"
+	HealthStatusFail    = "fail"
+	HealthStatusPending = "pending"
+)
+
+type HealthCheck struct {
+	Status  string    `json:"status"`
+	Details string    `json:"details,omitempty"`
+	Checked time.Time `json:"checked"`
+}
+
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks"`
+}
+
+// Ready is true if all checks passed
+func (h *HealthResponse) Ready() bool {
+	return h.Status == HealthStatusOK
+}
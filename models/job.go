@@ -9,16 +9,61 @@ package models
 
 import (
 	"bytes"
+	"time"
 )
 
 type JobRequestQuery struct {
-	Input       string `form:"input" binding:"required"`
-	Timeout     int    `form:"timeout" binding:"omitempty"`
-	PlotURLBase string `form:"ploturlbase" binding:"omitempty"`
-	Version     string `form:"version" binding:"omitempty"`
+	Input       string   `form:"input" binding:"required"`
+	Timeout     int      `form:"timeout" binding:"omitempty"`
+	PlotURLBase string   `form:"ploturlbase" binding:"omitempty"`
+	Version     string   `form:"version" binding:"omitempty"`
+	Priority    string   `form:"priority" binding:"omitempty,oneof=low normal high"`
+	RequestID   string   `form:"-"`
+	Client      string   `form:"-"`
+	ClientIP    string   `form:"-"`
+	SharedKey   bool     `form:"-"`
+	Versions    []string `form:"-"`
+}
+
+const (
+	JobPriorityLow    = "low"
+	JobPriorityNormal = "normal"
+	JobPriorityHigh   = "high"
+)
+
+// JobPriorities are all priorities, lowest first
+var JobPriorities = []string{JobPriorityLow, JobPriorityNormal, JobPriorityHigh}
+
+const (
+	JobOutcomeOK        = "ok"
+	JobOutcomeZIP       = "zip"
+	JobOutcomeTimeout   = "timeout"
+	JobOutcomeError     = "error"
+	JobOutcomeCancelled = "cancelled"
+	JobOutcomeKilled    = "killed"
+	JobOutcomeRejected  = "rejected"
+)
+
+type JobInfo struct {
+	ID        string    `json:"id"`
+	Client    string    `json:"client,omitempty"`
+	ClientIP  string    `json:"client_ip,omitempty"`
+	Version   string    `json:"version"`
+	Priority  string    `json:"priority"`
+	Started   time.Time `json:"started"`
+	Elapsed   float64   `json:"elapsed"`
+	PID       int       `json:"pid,omitempty"`
+	Workspace string    `json:"workspace,omitempty"`
+	InputSize int       `json:"input_size"`
 }
 
 type JobResponse struct {
-	Output *bytes.Buffer
-	IsZIP  bool
+	Output   *bytes.Buffer
+	IsZIP    bool
+	Version  string
+	Plots    int
+	Priority string
+	Duration time.Duration
+	CPUTime  time.Duration
+	Outcome  string
 }
@@ -0,0 +1,39 @@
+/*******************************************************************************
+ * Model: maxima snapshot administration
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package models
+
+import "time"
+
+type MaximaSnapshotDetails struct {
+	MaximaSnapshot
+	Default bool                `json:"default"`
+	Usage   MaximaSnapshotUsage `json:"usage"`
+}
+
+const (
+	MaximaSnapshotBuildOK        = "ok"
+	MaximaSnapshotBuildUnhealthy = "unhealthy"
+	MaximaSnapshotBuildError     = "error"
+)
+
+type MaximaSnapshotBuildResult struct {
+	Tag     string `json:"tag"`
+	Version string `json:"version,omitempty"`
+	Result  string `json:"result"`
+	Details string `json:"details,omitempty"`
+}
+
+type MaximaSnapshotRebuild struct {
+	Running  bool                        `json:"running"`
+	Started  time.Time                   `json:"started"`
+	Finished *time.Time                  `json:"finished,omitempty"`
+	Done     int                         `json:"done"`
+	Total    int                         `json:"total"`
+	Results  []MaximaSnapshotBuildResult `json:"results"`
+	Error    string                      `json:"error,omitempty"`
+}
@@ -0,0 +1,30 @@
+/*******************************************************************************
+ * Model: maxima snapshot bundle
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package models
+
+import (
+	"time"
+)
+
+const MaximaSnapshotBundleManifestFile = "manifest.json"
+
+type MaximaSnapshotBundleManifest struct {
+	Created   time.Time                   `json:"created"`
+	Snapshots []MaximaSnapshotBundleEntry `json:"snapshots"`
+}
+
+type MaximaSnapshotBundleEntry struct {
+	Version    string    `json:"version"`
+	Tags       []string  `json:"tags,omitempty"`
+	Healthy    bool      `json:"healthy"`
+	Deprecated bool      `json:"deprecated,omitempty"`
+	Created    time.Time `json:"created"`
+	File       string    `json:"file"`
+	Size       int64     `json:"size"`
+	SHA256     string    `json:"sha256"`
+}
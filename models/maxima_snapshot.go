@@ -8,38 +8,87 @@
 package models
 
 import (
+	"bytes"
 	"encoding/gob"
-	"github.com/spf13/viper"
-	"os"
-	"path"
+	"io"
+	"time"
 )
 
-type MaximaSnapshot string
+type MaximaSnapshot struct {
+	Version    string    `json:"version"`
+	Tags       []string  `json:"tags"`
+	Healthy    bool      `json:"healthy"`
+	Disabled   bool      `json:"disabled"`
+	Deprecated bool      `json:"deprecated"`
+	Created    time.Time `json:"created"`
+}
+
+// Usable is true if the snapshot may serve jobs; unhealthy snapshots are only used if forced
+func (s *MaximaSnapshot) Usable(force bool) bool {
+	return !s.Disabled && (s.Healthy || force)
+}
+
 type MaximaSnapshotList []MaximaSnapshot
 
-func (l *MaximaSnapshotList) Store() (err error) {
-	file, err := os.Create(path.Join(viper.GetString("storage.data"), "maxima-versions.gob"))
-	if err != nil {
-		return
-	}
+const MaximaSnapshotListFile = "maxima-versions.gob"
 
-	if err = gob.NewEncoder(file).Encode(l); err != nil {
+func (l *MaximaSnapshotList) Store(storage Storage) (err error) {
+	var buf bytes.Buffer
+	if err = gob.NewEncoder(&buf).Encode(l); err != nil {
 		return
 	}
 
-	err = file.Close()
-	return
+	return storage.Put(MaximaSnapshotListFile, &buf, int64(buf.Len()), 0644)
 }
 
-func (l *MaximaSnapshotList) Load() (err error) {
-	file, err := os.Open(path.Join(viper.GetString("storage.data"), "maxima-versions.gob"))
+func (l *MaximaSnapshotList) Load(storage Storage) (err error) {
+	file, err := storage.Open(MaximaSnapshotListFile)
+	if err != nil {
+		return
+	}
+	data, err := io.ReadAll(file)
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
 	if err != nil {
 		return
 	}
 
-	if err = gob.NewDecoder(file).Decode(&l); err != nil {
+	if err = gob.NewDecoder(bytes.NewReader(data)).Decode(l); err == nil {
 		return
 	}
-	err = file.Close()
-	return
+
+	// Lists of former releases only consist of version strings
+	var legacyList []string
+	if gob.NewDecoder(bytes.NewReader(data)).Decode(&legacyList) != nil {
+		*l = nil
+		return
+	}
+
+	*l = make(MaximaSnapshotList, 0, len(legacyList))
+	for _, item := range legacyList {
+		*l = append(*l, MaximaSnapshot{Version: item, Healthy: true})
+	}
+	return nil
+}
+
+// Get returns the snapshot of the given version or nil
+func (l *MaximaSnapshotList) Get(version string) *MaximaSnapshot {
+	for i := range *l {
+		if (*l)[i].Version == version {
+			return &(*l)[i]
+		}
+	}
+	return nil
+}
+
+// Remove deletes the snapshot of the given version from the list
+func (l *MaximaSnapshotList) Remove(version string) {
+	list := (*l)[:0]
+	for _, item := range *l {
+		if item.Version != version {
+			list = append(list, item)
+		}
+	}
+	*l = list
 }
@@ -0,0 +1,88 @@
+/*******************************************************************************
+ * Test: Model: maxima snapshots
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package models
+
+import (
+	"bytes"
+	"encoding/gob"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/fs"
+	"testing"
+)
+
+// testStorage keeps objects in memory
+type testStorage map[string][]byte
+
+func (s testStorage) List() (names []string, err error) {
+	for name := range s {
+		names = append(names, name)
+	}
+	return
+}
+
+func (s testStorage) Open(name string) (io.ReadCloser, error) {
+	if data, ok := s[name]; ok {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return nil, fs.ErrNotExist
+}
+
+func (s testStorage) Put(name string, r io.Reader, _ int64, _ fs.FileMode) (err error) {
+	s[name], err = io.ReadAll(r)
+	return
+}
+
+func (s testStorage) Remove(name string) error {
+	delete(s, name)
+	return nil
+}
+
+func (s testStorage) Local(string) (string, error) {
+	return "", fs.ErrNotExist
+}
+
+func TestMaximaSnapshotList_Load(t *testing.T) {
+	tests := []struct {
+		name     string
+		stored   any
+		wantList MaximaSnapshotList
+		wantErr  bool
+	}{
+		{"current list", &MaximaSnapshotList{{Version: "2023010400", Healthy: true}, {Version: "2023060500"}}, MaximaSnapshotList{{Version: "2023010400", Healthy: true}, {Version: "2023060500"}}, false},
+		{"legacy list", &[]string{"2023010400", "2023060500"}, MaximaSnapshotList{{Version: "2023010400", Healthy: true}, {Version: "2023060500", Healthy: true}}, false},
+		{"invalid list", &map[string]int{"2023010400": 1}, nil, true},
+		{"missing list", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := testStorage{}
+			if tt.stored != nil {
+				var buf bytes.Buffer
+				require.NoError(t, gob.NewEncoder(&buf).Encode(tt.stored))
+				require.NoError(t, storage.Put(MaximaSnapshotListFile, &buf, int64(buf.Len()), 0644))
+			}
+
+			var gotList MaximaSnapshotList
+			gotErr := gotList.Load(storage)
+			assert.Equal(t, tt.wantErr, gotErr != nil)
+			assert.Equal(t, tt.wantList, gotList)
+		})
+	}
+}
+
+func TestMaximaSnapshotList_Store(t *testing.T) {
+	storage := testStorage{}
+	list := MaximaSnapshotList{{Version: "2023010400", Healthy: true}}
+	require.NoError(t, list.Store(storage))
+
+	var gotList MaximaSnapshotList
+	require.NoError(t, gotList.Load(storage))
+	assert.Equal(t, list, gotList)
+}
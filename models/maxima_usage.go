@@ -0,0 +1,45 @@
+/*******************************************************************************
+ * Model: maxima snapshot usage
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package models
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"time"
+)
+
+const MaximaSnapshotUsageFile = "maxima-usage.gob"
+
+type MaximaSnapshotUsage struct {
+	Requests int64     `json:"requests"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+type MaximaSnapshotUsageMap map[string]MaximaSnapshotUsage
+
+func (m *MaximaSnapshotUsageMap) Store(storage Storage) (err error) {
+	var buf bytes.Buffer
+	if err = gob.NewEncoder(&buf).Encode(m); err != nil {
+		return
+	}
+
+	return storage.Put(MaximaSnapshotUsageFile, &buf, int64(buf.Len()), 0644)
+}
+
+func (m *MaximaSnapshotUsageMap) Load(storage Storage) (err error) {
+	file, err := storage.Open(MaximaSnapshotUsageFile)
+	if err != nil {
+		return
+	}
+	defer func(file io.ReadCloser) {
+		_ = file.Close()
+	}(file)
+
+	return gob.NewDecoder(file).Decode(m)
+}
@@ -0,0 +1,19 @@
+/*******************************************************************************
+ * Model: maxima versions
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package models
+
+type MaximaVersion struct {
+	Version    string   `json:"version"`
+	Aliases    []string `json:"aliases"`
+	Deprecated bool     `json:"deprecated"`
+}
+
+type MaximaVersionsResponse struct {
+	Default  string          `json:"default"`
+	Versions []MaximaVersion `json:"versions"`
+}
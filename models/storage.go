@@ -0,0 +1,32 @@
+/*******************************************************************************
+ * Model: storage
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package models
+
+import (
+	"io"
+	"io/fs"
+)
+
+// Storage is a backend holding snapshots and their metadata as named objects. Missing objects are reported as
+// fs.ErrNotExist.
+type Storage interface {
+	// List returns the names of all objects
+	List() ([]string, error)
+
+	// Open returns a reader of the object's content
+	Open(name string) (io.ReadCloser, error)
+
+	// Put replaces the object's content by size bytes of the reader
+	Put(name string, r io.Reader, size int64, mode fs.FileMode) error
+
+	// Remove deletes the object
+	Remove(name string) error
+
+	// Local returns the path of an executable copy of the object on local disk
+	Local(name string) (string, error)
+}
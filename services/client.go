@@ -0,0 +1,305 @@
+/*******************************************************************************
+ * Service: client
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	clientKeySeparator = "."
+	clientSecretLength = 32
+	clientHashSHA256   = "sha256:"
+	clientHashBcrypt   = "$2"
+	clientHashArgon2id = "$argon2id$"
+)
+
+type ErrClientInvalid struct {
+	Name   string
+	Reason string
+}
+
+func (e ErrClientInvalid) Error() string {
+	return fmt.Sprintf("client %q is invalid: %s", e.Name, e.Reason)
+}
+
+type ErrVersionForbidden string
+
+func (e ErrVersionForbidden) Error() string {
+	return "client may not use version " + string(e)
+}
+
+var (
+	clientNameRegex = regexp.MustCompile("^[A-Za-z0-9._-]{1,64}$")
+	clientScopes    = []string{models.ClientScopeJob, models.ClientScopeAdmin, models.ClientScopeMetrics}
+	clientList      []models.Client
+	clientMutex     sync.RWMutex
+
+	// clientKeyCache maps the SHA-256 of a slow hash and its key to the expiry of their successful verification
+	clientKeyCache      = make(map[[sha256.Size]byte]time.Time)
+	clientKeyCacheMutex sync.Mutex
+)
+
+// ClientLoad reads the clients of `server.keys_file` and adds the keys `server.api_key`, `server.admin.api_key` and
+// `server.metrics.api_key` as clients without name, which accept any username
+func ClientLoad() error {
+	var clients []models.Client
+	var modified time.Time
+	if keysFile := viper.GetString("server.keys_file"); keysFile != "" {
+		if info, err := os.Stat(keysFile); err == nil {
+			modified = info.ModTime()
+		}
+		store, err := clientStoreRead()
+		if err != nil {
+			return err
+		}
+		clients = store.Clients
+	}
+	if err := clientValidate(clients); err != nil {
+		return err
+	}
+
+	for scope, configKey := range map[string]string{
+		models.ClientScopeJob:     "server.api_key",
+		models.ClientScopeAdmin:   "server.admin.api_key",
+		models.ClientScopeMetrics: "server.metrics.api_key",
+	} {
+		if key := viper.GetString(configKey); key != "" {
+			clients = append(clients, models.Client{Key: clientKeyHashSHA256(key), Scopes: []string{scope}})
+		}
+	}
+
+	clientMutex.Lock()
+	defer clientMutex.Unlock()
+	clientList = clients
+	clientStoreModified = modified
+	return nil
+}
+
+func clientValidate(clients []models.Client) error {
+	names := make(map[string]bool)
+	for _, client := range clients {
+		if !clientNameRegex.MatchString(client.Name) {
+			return ErrClientInvalid{Name: client.Name, Reason: "name has to match " + clientNameRegex.String()}
+		}
+		if names[client.Name] {
+			return ErrClientInvalid{Name: client.Name, Reason: "name is not unique"}
+		}
+		names[client.Name] = true
+
+		if (client.Key != "" || client.Subject == "" && client.Secret == "") && !clientKeyValid(client.Key) {
+			return ErrClientInvalid{Name: client.Name, Reason: "key is no SHA-256, bcrypt or Argon2id hash"}
+		}
+		if client.Secret != "" && len(client.Secret) < clientSecretLength {
+			return ErrClientInvalid{Name: client.Name, Reason: fmt.Sprintf("secret is shorter than %d characters", clientSecretLength)}
+		}
+		for _, scope := range client.Scopes {
+			if !slices.Contains(clientScopes, scope) {
+				return ErrClientInvalid{Name: client.Name, Reason: "unknown scope " + scope}
+			}
+		}
+		for _, network := range client.Networks {
+			if _, err := models.ParseNetwork(network); err != nil {
+				return ErrClientInvalid{Name: client.Name, Reason: "invalid network " + network}
+			}
+		}
+	}
+	return nil
+}
+
+// ClientAuthenticate returns the enabled client with the scope and key; name is the username of HTTP Basic Auth and
+// empty for an API key via header. Keys of `keys create` are prefixed by the client's name (`<name>.<key>`), which
+// like the username selects the only client whose bcrypt or Argon2id hash is verified; SHA-256 hashes are cheap and
+// checked for all clients.
+func ClientAuthenticate(name string, key string, scope string) (*models.Client, bool) {
+	owner := name
+	if index := strings.LastIndex(key, clientKeySeparator); owner == "" && index > 0 {
+		owner = key[:index]
+	}
+
+	clientMutex.RLock()
+	defer clientMutex.RUnlock()
+
+	for _, client := range clientList {
+		if client.Disabled || !client.HasScope(scope) || (client.Name != "" && name != "" && client.Name != name) {
+			continue
+		}
+		if client.Name != owner && !strings.HasPrefix(client.Key, clientHashSHA256) {
+			continue
+		}
+		if clientKeyVerifyCached(client.Key, key) {
+			if client.Name == "" {
+				client.Name, client.SharedKey = name, true
+			}
+			return &client, true
+		}
+	}
+	return nil, false
+}
+
+// ClientAuthenticateCertificate returns the enabled client with the scope whose subject is the common name or the
+// distinguished name of the verified certificate
+func ClientAuthenticateCertificate(certificate *x509.Certificate, scope string) (*models.Client, bool) {
+	clientMutex.RLock()
+	defer clientMutex.RUnlock()
+
+	for _, client := range clientList {
+		if client.Disabled || !client.HasScope(scope) || client.Subject == "" {
+			continue
+		}
+		if client.Subject == certificate.Subject.CommonName || client.Subject == certificate.Subject.String() {
+			return &client, true
+		}
+	}
+	return nil, false
+}
+
+// ClientScopeOpen reports whether no client is configured for the scope, so its endpoints are not protected;
+// administration is never open
+func ClientScopeOpen(scope string) bool {
+	if scope == models.ClientScopeAdmin {
+		return false
+	}
+
+	clientMutex.RLock()
+	defer clientMutex.RUnlock()
+
+	for _, client := range clientList {
+		if client.HasScope(scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// clientAllowsVersion checks the allowed versions of a client against the version and tags of a snapshot
+func clientAllowsVersion(versions []string, version string) bool {
+	maximaSnapshotMutex.RLock()
+	defer maximaSnapshotMutex.RUnlock()
+
+	client := models.Client{Versions: versions}
+	if item := maximaSnapshotList.Get(version); item != nil {
+		return client.AllowsVersion(version, item.Tags)
+	}
+	return client.AllowsVersion(version, nil)
+}
+
+func clientKeyHashSHA256(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return clientHashSHA256 + hex.EncodeToString(sum[:])
+}
+
+func clientKeyValid(hash string) bool {
+	switch {
+	case strings.HasPrefix(hash, clientHashSHA256):
+		sum, err := hex.DecodeString(strings.TrimPrefix(hash, clientHashSHA256))
+		return err == nil && len(sum) == sha256.Size
+	case strings.HasPrefix(hash, clientHashArgon2id):
+		_, _, _, _, _, err := clientArgon2idParse(hash)
+		return err == nil
+	case strings.HasPrefix(hash, clientHashBcrypt):
+		_, err := bcrypt.Cost([]byte(hash))
+		return err == nil
+	}
+	return false
+}
+
+// clientKeyVerify compares the key with its hash in constant time
+func clientKeyVerify(hash string, key string) bool {
+	switch {
+	case strings.HasPrefix(hash, clientHashSHA256):
+		want, err := hex.DecodeString(strings.TrimPrefix(hash, clientHashSHA256))
+		sum := sha256.Sum256([]byte(key))
+		return err == nil && subtle.ConstantTimeCompare(sum[:], want) == 1
+	case strings.HasPrefix(hash, clientHashArgon2id):
+		memory, iterations, threads, salt, want, err := clientArgon2idParse(hash)
+		if err != nil {
+			return false
+		}
+		sum := argon2.IDKey([]byte(key), salt, iterations, memory, threads, uint32(len(want)))
+		return subtle.ConstantTimeCompare(sum, want) == 1
+	case strings.HasPrefix(hash, clientHashBcrypt):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(key)) == nil
+	}
+	return false
+}
+
+// clientKeyVerifyCached verifies the key like clientKeyVerify, but remembers successful verifications of bcrypt and
+// Argon2id hashes for `server.keys_cache`
+func clientKeyVerifyCached(hash string, key string) bool {
+	if strings.HasPrefix(hash, clientHashSHA256) {
+		return clientKeyVerify(hash, key)
+	}
+
+	cacheKey := sha256.Sum256([]byte(hash + "\n" + key))
+	now := time.Now()
+	clientKeyCacheMutex.Lock()
+	expires, ok := clientKeyCache[cacheKey]
+	clientKeyCacheMutex.Unlock()
+	if ok && now.Before(expires) {
+		return true
+	}
+
+	if !clientKeyVerify(hash, key) {
+		return false
+	}
+	if ttl := viper.GetDuration("server.keys_cache"); ttl > 0 {
+		clientKeyCacheMutex.Lock()
+		defer clientKeyCacheMutex.Unlock()
+		for cached, cachedExpires := range clientKeyCache {
+			if !now.Before(cachedExpires) {
+				delete(clientKeyCache, cached)
+			}
+		}
+		clientKeyCache[cacheKey] = now.Add(ttl)
+	}
+	return true
+}
+
+// clientArgon2idParse parses a hash in PHC format, e.g. `$argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>`
+func clientArgon2idParse(hash string) (memory uint32, iterations uint32, threads uint8, salt []byte, sum []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		err = ErrClientInvalid{Reason: "malformed Argon2id hash"}
+		return
+	}
+
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return
+	}
+	if version != argon2.Version {
+		err = ErrClientInvalid{Reason: fmt.Sprintf("unsupported Argon2 version %d", version)}
+		return
+	}
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return
+	}
+	if sum, err = base64.RawStdEncoding.DecodeString(parts[5]); err == nil && len(sum) == 0 {
+		err = ErrClientInvalid{Reason: "empty Argon2id hash"}
+	}
+	return
+}
@@ -0,0 +1,255 @@
+/*******************************************************************************
+ * Service: client limit
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"cmp"
+	"fmt"
+	"github.com/spf13/viper"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+type ErrRateLimited struct {
+	RetryAfter time.Duration
+}
+
+func (e ErrRateLimited) Error() string {
+	return fmt.Sprintf("rate limit exceeded, retry after %s", e.RetryAfter)
+}
+
+type ErrQuotaExceeded struct {
+	Quota      string
+	RetryAfter time.Duration
+}
+
+func (e ErrQuotaExceeded) Error() string {
+	return fmt.Sprintf("%s quota exceeded, retry after %s", e.Quota, e.RetryAfter)
+}
+
+type ErrLimitsInvalid struct {
+	Name   string
+	Reason string
+}
+
+func (e ErrLimitsInvalid) Error() string {
+	if e.Name == "" {
+		return "default limits are invalid: " + e.Reason
+	}
+	return fmt.Sprintf("limits of client %q are invalid: %s", e.Name, e.Reason)
+}
+
+type clientBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// clientLimitEvictInterval is the interval to remove full buckets and usage of past windows
+const clientLimitEvictInterval = time.Minute
+
+var (
+	clientLimits      map[string]models.ClientLimits
+	clientBuckets     = make(map[string]*clientBucket)
+	clientUsage       models.ClientUsageMap
+	clientEvicted     time.Time
+	clientLimitsMutex sync.Mutex
+)
+
+// clientLimitAdmit takes a token of the client's bucket and checks its quotas
+func clientLimitAdmit(client string, now time.Time) error {
+	clientLimitsMutex.Lock()
+	defer clientLimitsMutex.Unlock()
+
+	limits := clientLimitsGet(client)
+	clientUsageLoad()
+	if now.Sub(clientEvicted) >= clientLimitEvictInterval {
+		clientLimitEvict(now)
+	}
+	usage := clientUsage[client]
+	usage.Reset(now)
+	nextHour := usage.Hour.Add(time.Hour).Sub(now)
+	nextDay := usage.Day.AddDate(0, 0, 1).Sub(now)
+
+	for _, quota := range []struct {
+		name       string
+		used       time.Duration
+		limit      time.Duration
+		retryAfter time.Duration
+	}{
+		{"hourly wall time", usage.HourWallTime, limits.WallTime.Hour, nextHour},
+		{"daily wall time", usage.DayWallTime, limits.WallTime.Day, nextDay},
+		{"hourly CPU time", usage.HourCPUTime, limits.CPUTime.Hour, nextHour},
+		{"daily CPU time", usage.DayCPUTime, limits.CPUTime.Day, nextDay},
+	} {
+		if quota.limit > 0 && quota.used >= quota.limit {
+			metricClientLimited.WithLabelValues("quota").Inc()
+			return ErrQuotaExceeded{Quota: quota.name, RetryAfter: quota.retryAfter}
+		}
+	}
+
+	if limits.Rate <= 0 {
+		return nil
+	}
+	burst := clientLimitBurst(limits)
+	bucket, ok := clientBuckets[client]
+	if !ok {
+		bucket = &clientBucket{tokens: burst, updated: now}
+		clientBuckets[client] = bucket
+	}
+	bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*limits.Rate)
+	bucket.updated = now
+	if bucket.tokens < 1 {
+		metricClientLimited.WithLabelValues("rate").Inc()
+		return ErrRateLimited{RetryAfter: time.Duration((1 - bucket.tokens) / limits.Rate * float64(time.Second))}
+	}
+	bucket.tokens--
+	return nil
+}
+
+// clientLimitBurst returns the size of a bucket, which defaults to the rate rounded up
+func clientLimitBurst(limits models.ClientLimits) float64 {
+	if limits.Burst >= 1 {
+		return float64(limits.Burst)
+	}
+	return math.Max(1, math.Ceil(limits.Rate))
+}
+
+// clientLimitEvict removes buckets which are refilled and usage without time in the current windows, so they do not
+// pile up for clients seen once; the caller must hold clientLimitsMutex
+func clientLimitEvict(now time.Time) {
+	clientEvicted = now
+	for client, bucket := range clientBuckets {
+		limits := clientLimitsGet(client)
+		if limits.Rate <= 0 || bucket.tokens+now.Sub(bucket.updated).Seconds()*limits.Rate >= clientLimitBurst(limits) {
+			delete(clientBuckets, client)
+		}
+	}
+	for client, usage := range clientUsage {
+		usage.Reset(now)
+		if usage.HourWallTime == 0 && usage.HourCPUTime == 0 && usage.DayWallTime == 0 && usage.DayCPUTime == 0 {
+			delete(clientUsage, client)
+		}
+	}
+}
+
+// clientLimitRecord adds the time consumed by a job to the quotas of the client
+func clientLimitRecord(client string, now time.Time, wallTime time.Duration, cpuTime time.Duration) {
+	clientLimitsMutex.Lock()
+	defer clientLimitsMutex.Unlock()
+
+	clientUsageLoad()
+	usage := clientUsage[client]
+	usage.Reset(now)
+	usage.HourWallTime += wallTime
+	usage.DayWallTime += wallTime
+	usage.HourCPUTime += cpuTime
+	usage.DayCPUTime += cpuTime
+	clientUsage[client] = usage
+}
+
+// clientLimitsFor returns the limits of the client
+func clientLimitsFor(client string) models.ClientLimits {
+	clientLimitsMutex.Lock()
+	defer clientLimitsMutex.Unlock()
+	return clientLimitsGet(client)
+}
+
+// ClientLimitsLoad reads and validates the limits of `limits.default` and `limits.clients`
+func ClientLimitsLoad() error {
+	limits, err := clientLimitsParse()
+	if err != nil {
+		return err
+	}
+
+	clientLimitsMutex.Lock()
+	defer clientLimitsMutex.Unlock()
+	clientLimits = limits
+	return nil
+}
+
+// clientLimitsGet returns the limits of `limits.clients` for the client, whose unset values are those of
+// `limits.default`; the caller must hold clientLimitsMutex
+func clientLimitsGet(client string) models.ClientLimits {
+	if clientLimits == nil {
+		clientLimits, _ = clientLimitsParse()
+	}
+
+	if limits, ok := clientLimits[client]; ok {
+		return limits
+	}
+	return clientLimits[""]
+}
+
+// clientLimitsParse returns the limits by client name, those of `limits.default` by the empty name. The priority
+// defaults to normal and the max priority to the priority; a client with its own priority does not inherit the
+// default max priority.
+func clientLimitsParse() (map[string]models.ClientLimits, error) {
+	var defaults models.ClientLimits
+	var clients []models.ClientLimits
+	_ = viper.UnmarshalKey("limits.default", &defaults)
+	_ = viper.UnmarshalKey("limits.clients", &clients)
+
+	defaults.Priority = cmp.Or(defaults.Priority, models.JobPriorityNormal)
+	defaults.MaxPriority = cmp.Or(defaults.MaxPriority, defaults.Priority)
+	limits := map[string]models.ClientLimits{"": defaults}
+	for _, client := range clients {
+		maxPriority := client.MaxPriority
+		if maxPriority == "" && client.Priority == "" {
+			maxPriority = defaults.MaxPriority
+		}
+		limits[client.Name] = models.ClientLimits{
+			Name:     client.Name,
+			Rate:     cmp.Or(client.Rate, defaults.Rate),
+			Burst:    cmp.Or(client.Burst, defaults.Burst),
+			WallTime: models.ClientQuota{Hour: cmp.Or(client.WallTime.Hour, defaults.WallTime.Hour), Day: cmp.Or(client.WallTime.Day, defaults.WallTime.Day)},
+			CPUTime:  models.ClientQuota{Hour: cmp.Or(client.CPUTime.Hour, defaults.CPUTime.Hour), Day: cmp.Or(client.CPUTime.Day, defaults.CPUTime.Day)},
+
+			Weight:      cmp.Or(client.Weight, defaults.Weight),
+			MaxInFlight: cmp.Or(client.MaxInFlight, defaults.MaxInFlight),
+			Priority:    cmp.Or(client.Priority, defaults.Priority),
+			MaxPriority: cmp.Or(maxPriority, client.Priority, defaults.Priority),
+		}
+	}
+
+	for name, limit := range limits {
+		for _, priority := range []string{limit.Priority, limit.MaxPriority} {
+			if !slices.Contains(models.JobPriorities, priority) {
+				return nil, ErrLimitsInvalid{Name: name, Reason: "unknown priority " + priority}
+			}
+		}
+		if slices.Index(models.JobPriorities, limit.MaxPriority) < slices.Index(models.JobPriorities, limit.Priority) {
+			return nil, ErrLimitsInvalid{Name: name, Reason: "max_priority is below priority"}
+		}
+	}
+	return limits, nil
+}
+
+// clientUsageLoad reads the persisted usage if `limits.persist` is enabled and it is not loaded yet; the caller must
+// hold clientLimitsMutex
+func clientUsageLoad() {
+	if clientUsage == nil {
+		clientUsage = make(models.ClientUsageMap)
+		if viper.GetBool("limits.persist") {
+			_ = clientUsage.Load()
+		}
+	}
+}
+
+// ClientUsageStore persists the usage of all clients if `limits.persist` is enabled
+func ClientUsageStore() error {
+	clientLimitsMutex.Lock()
+	defer clientLimitsMutex.Unlock()
+
+	if clientUsage == nil || !viper.GetBool("limits.persist") {
+		return nil
+	}
+	return clientUsage.Store()
+}
@@ -0,0 +1,202 @@
+/*******************************************************************************
+ * Test: Service: client limit
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"context"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func resetClientLimits() {
+	clientLimits = nil
+	clientBuckets = make(map[string]*clientBucket)
+	clientUsage = nil
+	clientEvicted = time.Time{}
+}
+
+func Test_clientLimitAdmit_rate(t *testing.T) {
+	viper.Set("limits.default", map[string]any{"rate": 2, "burst": 2})
+	viper.Set("limits.clients", []map[string]any{{"name": "fast", "rate": 100}})
+	resetClientLimits()
+	defer func() {
+		viper.Set("limits.default", nil)
+		viper.Set("limits.clients", nil)
+		resetClientLimits()
+	}()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, clientLimitAdmit("moodle", now))
+	assert.NoError(t, clientLimitAdmit("moodle", now))
+	assert.Equal(t, ErrRateLimited{RetryAfter: 500 * time.Millisecond}, clientLimitAdmit("moodle", now))
+
+	// Tokens refill with the rate and buckets are independent per client
+	assert.NoError(t, clientLimitAdmit("moodle", now.Add(500*time.Millisecond)))
+	assert.NoError(t, clientLimitAdmit("other", now))
+
+	// Unset limits of a client are inherited
+	assert.Equal(t, models.ClientLimits{Name: "fast", Rate: 100, Burst: 2, Priority: models.JobPriorityNormal, MaxPriority: models.JobPriorityNormal}, clientLimitsGet("fast"))
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, clientLimitAdmit("fast", now))
+	}
+	assert.NoError(t, clientLimitAdmit("fast", now.Add(10*time.Millisecond)))
+}
+
+func Test_clientLimitAdmit_quota(t *testing.T) {
+	viper.Set("limits.default", map[string]any{"wall_time": map[string]any{"hour": "10m"}, "cpu_time": map[string]any{"day": "15m"}})
+	resetClientLimits()
+	defer func() {
+		viper.Set("limits.default", nil)
+		resetClientLimits()
+	}()
+
+	now := time.Date(2024, 1, 1, 12, 45, 0, 0, time.Local)
+	assert.NoError(t, clientLimitAdmit("moodle", now))
+	clientLimitRecord("moodle", now, 10*time.Minute, 8*time.Minute)
+	assert.Equal(t, ErrQuotaExceeded{Quota: "hourly wall time", RetryAfter: 15 * time.Minute}, clientLimitAdmit("moodle", now))
+	assert.NoError(t, clientLimitAdmit("other", now))
+
+	// The hourly quota is reset, the daily one remains
+	now = now.Add(time.Hour)
+	assert.NoError(t, clientLimitAdmit("moodle", now))
+	clientLimitRecord("moodle", now, time.Minute, 8*time.Minute)
+	assert.Equal(t, ErrQuotaExceeded{Quota: "daily CPU time", RetryAfter: 10*time.Hour + 15*time.Minute}, clientLimitAdmit("moodle", now))
+	assert.NoError(t, clientLimitAdmit("moodle", now.Add(11*time.Hour)))
+}
+
+func TestClientLimitsLoad(t *testing.T) {
+	defer func() {
+		viper.Set("limits.default", nil)
+		viper.Set("limits.clients", nil)
+		resetClientLimits()
+	}()
+
+	tests := []struct {
+		name            string
+		defaults        map[string]any
+		clients         []map[string]any
+		client          string
+		wantPriority    string
+		wantMaxPriority string
+		wantErr         error
+	}{
+		{"defaults", nil, nil, "moodle", models.JobPriorityNormal, models.JobPriorityNormal, nil},
+		{"default max priority", map[string]any{"max_priority": "high"}, []map[string]any{{"name": "moodle"}}, "moodle", models.JobPriorityNormal, models.JobPriorityHigh, nil},
+		{"own priority", map[string]any{"max_priority": "high"}, []map[string]any{{"name": "batch", "priority": "low"}}, "batch", models.JobPriorityLow, models.JobPriorityLow, nil},
+		{"own max priority", nil, []map[string]any{{"name": "batch", "priority": "low", "max_priority": "normal"}}, "batch", models.JobPriorityLow, models.JobPriorityNormal, nil},
+		{"unknown priority", nil, []map[string]any{{"name": "batch", "priority": "urgent"}}, "", "", "", ErrLimitsInvalid{Name: "batch", Reason: "unknown priority urgent"}},
+		{"unknown default max priority", map[string]any{"max_priority": "urgent"}, nil, "", "", "", ErrLimitsInvalid{Reason: "unknown priority urgent"}},
+		{"max priority below priority", nil, []map[string]any{{"name": "batch", "priority": "high", "max_priority": "low"}}, "", "", "", ErrLimitsInvalid{Name: "batch", Reason: "max_priority is below priority"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("limits.default", tt.defaults)
+			viper.Set("limits.clients", tt.clients)
+			resetClientLimits()
+
+			err := ClientLimitsLoad()
+			assert.Equal(t, tt.wantErr, err)
+			if tt.wantErr == nil {
+				limits := clientLimitsFor(tt.client)
+				assert.Equal(t, tt.wantPriority, limits.Priority)
+				assert.Equal(t, tt.wantMaxPriority, limits.MaxPriority)
+			}
+		})
+	}
+}
+
+func Test_clientLimitEvict(t *testing.T) {
+	viper.Set("limits.default", map[string]any{"rate": 1, "burst": 2, "wall_time": map[string]any{"hour": "10m"}})
+	resetClientLimits()
+	defer func() {
+		viper.Set("limits.default", nil)
+		resetClientLimits()
+	}()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	for _, client := range []string{"idle", "busy"} {
+		require.NoError(t, clientLimitAdmit(client, now))
+		clientLimitRecord(client, now, time.Minute, 0)
+	}
+
+	// Buckets are removed once refilled, usage once its windows passed
+	now = now.Add(clientLimitEvictInterval)
+	require.NoError(t, clientLimitAdmit("busy", now))
+	clientLimitRecord("busy", now, time.Minute, 0)
+	clientLimitEvict(now)
+	assert.NotContains(t, clientBuckets, "idle")
+	assert.Contains(t, clientBuckets, "busy")
+	assert.Contains(t, clientUsage, "idle")
+
+	clientLimitEvict(now.AddDate(0, 0, 1))
+	assert.Empty(t, clientBuckets)
+	assert.Empty(t, clientUsage)
+}
+
+func TestClientUsageStore(t *testing.T) {
+	viper.Set("storage.data", t.TempDir())
+	viper.Set("limits.persist", true)
+	viper.Set("limits.default", map[string]any{"wall_time": map[string]any{"day": "1m"}})
+	resetClientLimits()
+	defer func() {
+		viper.Set("limits.persist", false)
+		viper.Set("limits.default", nil)
+		resetClientLimits()
+	}()
+
+	now := time.Now()
+	clientLimitRecord("moodle", now, time.Minute, 0)
+	require.NoError(t, ClientUsageStore())
+
+	// Quotas survive a restart
+	resetClientLimits()
+	assert.IsType(t, ErrQuotaExceeded{}, clientLimitAdmit("moodle", now))
+}
+
+func TestJobCreate_limits(t *testing.T) {
+	viper.Set("job.user", nil)
+	viper.Set("job.timeout", 10*time.Second)
+	viper.Set("job.concurrency", 0)
+	viper.Set("storage.backend", "local")
+	viper.Set("storage.workspace", t.TempDir())
+	viper.Set("storage.data", t.TempDir())
+	viper.Set("limits.default", map[string]any{"cpu_time": map[string]any{"hour": "1ms"}})
+	maximaSnapshotList = models.MaximaSnapshotList{{Version: "2023010400", Healthy: true}}
+	jobSlots = nil
+	resetClientLimits()
+	defer func() {
+		viper.Set("limits.default", nil)
+		maximaSnapshotList = nil
+		jobSlots = nil
+		resetClientLimits()
+	}()
+
+	// Burns CPU time in a child process
+	createTestSnapshot(t, "2023010400", `cat > /dev/null; sh -c 'i=0; while [ $i -lt 20000 ]; do i=$((i+1)); done'; echo OUTPUT`)
+
+	resp, err := JobCreate(context.Background(), &models.JobRequestQuery{Input: "1+1;", Timeout: 10000, Client: "moodle"})
+	require.NoError(t, err)
+	assert.Greater(t, resp.CPUTime, time.Duration(0))
+
+	resp, err = JobCreate(context.Background(), &models.JobRequestQuery{Input: "1+1;", Timeout: 10000, Client: "moodle"})
+	require.IsType(t, ErrQuotaExceeded{}, err)
+	assert.Equal(t, "hourly CPU time", err.(ErrQuotaExceeded).Quota)
+	assert.Equal(t, models.JobOutcomeRejected, resp.Outcome)
+
+	// Clients of a shared key cannot evade quotas by another username
+	shared := &models.JobRequestQuery{Input: "1+1;", Timeout: 10000, Client: "someone", ClientIP: "192.0.2.1", SharedKey: true}
+	_, err = JobCreate(context.Background(), shared)
+	require.NoError(t, err)
+	shared.Client = "someone-else"
+	_, err = JobCreate(context.Background(), shared)
+	assert.IsType(t, ErrQuotaExceeded{}, err)
+}
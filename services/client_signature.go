@@ -0,0 +1,166 @@
+/*******************************************************************************
+ * Service: signed requests of clients
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/spf13/viper"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ErrSignatureInvalid struct{}
+
+func (e ErrSignatureInvalid) Error() string {
+	return "signature of the request is invalid"
+}
+
+type ErrSignatureExpired struct{}
+
+func (e ErrSignatureExpired) Error() string {
+	return "timestamp of the signed request is outside of the allowed clock skew"
+}
+
+type ErrNonceReplayed string
+
+func (e ErrNonceReplayed) Error() string {
+	return "nonce " + string(e) + " was already used"
+}
+
+type ErrNonceCacheFull struct{}
+
+func (e ErrNonceCacheFull) Error() string {
+	return "cache of nonces is full"
+}
+
+// ClientSignature is a request signed by a client with `X-Client`, `X-Timestamp`, `X-Nonce` and `X-Signature`; its
+// body is only read once the headers are valid
+type ClientSignature struct {
+	Client    string
+	Timestamp string
+	Nonce     string
+	Signature string
+	Method    string
+	URI       string
+	Body      func() ([]byte, error)
+}
+
+type clientNonce struct {
+	key     string
+	expires time.Time
+}
+
+// clientNonceCache remembers the nonces of accepted requests until their timestamp is outside of the allowed clock
+// skew; its entries expire in the order they were added
+type clientNonceCache struct {
+	mutex  sync.Mutex
+	seen   map[string]bool
+	queue  []clientNonce
+	expiry time.Duration
+	size   int
+}
+
+var (
+	clientNonceRegex = regexp.MustCompile("^[A-Za-z0-9._-]{16,128}$")
+	clientNonces     *clientNonceCache
+	clientNoncesOnce sync.Once
+)
+
+// ClientAuthenticateSignature returns the enabled client with the scope whose secret signed the request; the
+// timestamp has to be within `server.signature.skew` and the nonce must not be used twice. The body is read after the
+// client, nonce and timestamp are checked.
+func ClientAuthenticateSignature(signature ClientSignature, scope string, now time.Time) (*models.Client, error) {
+	client, ok := clientBySecret(signature.Client, scope)
+	if !ok || !clientNonceRegex.MatchString(signature.Nonce) {
+		return nil, ErrSignatureInvalid{}
+	}
+	want, err := hex.DecodeString(signature.Signature)
+	if err != nil || len(want) != sha256.Size {
+		return nil, ErrSignatureInvalid{}
+	}
+
+	timestamp, err := strconv.ParseInt(signature.Timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrSignatureInvalid{}
+	}
+	skew := viper.GetDuration("server.signature.skew")
+	if offset := now.Sub(time.Unix(timestamp, 0)); offset > skew || offset < -skew {
+		return nil, ErrSignatureExpired{}
+	}
+
+	var body []byte
+	if signature.Body != nil {
+		if body, err = signature.Body(); err != nil {
+			return nil, err
+		}
+	}
+	if !hmac.Equal(clientSign(client.Secret, signature, body), want) {
+		return nil, ErrSignatureInvalid{}
+	}
+
+	clientNoncesOnce.Do(func() {
+		clientNonces = &clientNonceCache{seen: make(map[string]bool), expiry: 2 * skew, size: viper.GetInt("server.signature.nonce_cache")}
+	})
+	if err = clientNonces.add(client.Name, signature.Nonce, now); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// clientSign computes the HMAC-SHA256 of method, URI, timestamp, nonce and the SHA-256 of the body, each on its own
+// line
+func clientSign(secret string, signature ClientSignature, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join([]string{signature.Method, signature.URI, signature.Timestamp, signature.Nonce, hex.EncodeToString(sum[:])}, "\n")))
+	return mac.Sum(nil)
+}
+
+func clientBySecret(name string, scope string) (*models.Client, bool) {
+	clientMutex.RLock()
+	defer clientMutex.RUnlock()
+
+	for _, client := range clientList {
+		if client.Name == name && client.Secret != "" && !client.Disabled && client.HasScope(scope) {
+			return &client, true
+		}
+	}
+	return nil, false
+}
+
+// add remembers the nonce or rejects it as replay; a cache full of valid nonces rejects all requests instead of
+// forgetting a nonce which could be replayed then
+func (n *clientNonceCache) add(client string, nonce string, now time.Time) error {
+	key := client + "\n" + nonce
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	expired := 0
+	for expired < len(n.queue) && !now.Before(n.queue[expired].expires) {
+		delete(n.seen, n.queue[expired].key)
+		expired++
+	}
+	n.queue = n.queue[expired:]
+
+	if n.seen[key] {
+		return ErrNonceReplayed(nonce)
+	}
+	if len(n.queue) >= n.size {
+		return ErrNonceCacheFull{}
+	}
+	n.seen[key] = true
+	n.queue = append(n.queue, clientNonce{key: key, expires: now.Add(n.expiry)})
+	return nil
+}
@@ -0,0 +1,120 @@
+/*******************************************************************************
+ * Test: Service: signed requests of clients
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"encoding/hex"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testClientSecret = "0123456789abcdef0123456789abcdef"
+
+func resetClientNonces() {
+	clientNonces = nil
+	clientNoncesOnce = sync.Once{}
+}
+
+func testClientSignature(now time.Time, nonce string, body string) ClientSignature {
+	signature := ClientSignature{
+		Client:    "moodle",
+		Timestamp: strconv.FormatInt(now.Unix(), 10),
+		Nonce:     nonce,
+		Method:    "POST",
+		URI:       "/MaximaPool/MaximaPool",
+		Body:      testClientBody(body),
+	}
+	signature.Signature = hex.EncodeToString(clientSign(testClientSecret, signature, []byte(body)))
+	return signature
+}
+
+func testClientBody(body string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		return []byte(body), nil
+	}
+}
+
+func TestClientAuthenticateSignature(t *testing.T) {
+	viper.Set("server.signature.skew", 5*time.Minute)
+	viper.Set("server.signature.nonce_cache", 2)
+	clientList = []models.Client{
+		{Name: "moodle", Secret: testClientSecret, Scopes: []string{models.ClientScopeJob}},
+		{Name: "disabled", Secret: testClientSecret, Scopes: []string{models.ClientScopeJob}, Disabled: true},
+	}
+	resetClientNonces()
+	defer func() {
+		viper.Set("server.signature.skew", nil)
+		viper.Set("server.signature.nonce_cache", nil)
+		clientList = nil
+		resetClientNonces()
+	}()
+
+	now := time.Now()
+	tampered := testClientSignature(now, "nonce-tampered-0001", "input=1+1;")
+	tampered.Body = testClientBody("input=2+2;")
+	disabled := testClientSignature(now, "nonce-disabled-0001", "input=1+1;")
+	disabled.Client = "disabled"
+	disabled.Signature = hex.EncodeToString(clientSign(testClientSecret, disabled, []byte("input=1+1;")))
+	malformed := testClientSignature(now, "nonce-malformed-001", "input=1+1;")
+	malformed.Signature = "zz"
+
+	tests := []struct {
+		name      string
+		signature ClientSignature
+		scope     string
+		now       time.Time
+		wantErr   error
+	}{
+		{"valid", testClientSignature(now, "nonce-valid-000001", "input=1+1;"), models.ClientScopeJob, now, nil},
+		{"replay", testClientSignature(now, "nonce-valid-000001", "input=1+1;"), models.ClientScopeJob, now, ErrNonceReplayed("nonce-valid-000001")},
+		{"tampered body", tampered, models.ClientScopeJob, now, ErrSignatureInvalid{}},
+		{"malformed signature", malformed, models.ClientScopeJob, now, ErrSignatureInvalid{}},
+		{"disabled client", disabled, models.ClientScopeJob, now, ErrSignatureInvalid{}},
+		{"missing scope", testClientSignature(now, "nonce-scope-000001", ""), models.ClientScopeAdmin, now, ErrSignatureInvalid{}},
+		{"short nonce", testClientSignature(now, "nonce", ""), models.ClientScopeJob, now, ErrSignatureInvalid{}},
+		{"expired", testClientSignature(now.Add(-6*time.Minute), "nonce-expired-0001", ""), models.ClientScopeJob, now, ErrSignatureExpired{}},
+		{"future", testClientSignature(now.Add(6*time.Minute), "nonce-future-00001", ""), models.ClientScopeJob, now, ErrSignatureExpired{}},
+		{"within skew", testClientSignature(now.Add(-4*time.Minute), "nonce-skew-0000001", ""), models.ClientScopeJob, now, nil},
+		{"full cache", testClientSignature(now, "nonce-full-0000001", ""), models.ClientScopeJob, now, ErrNonceCacheFull{}},
+		{"expired nonces", testClientSignature(now.Add(10*time.Minute), "nonce-later-000001", ""), models.ClientScopeJob, now.Add(10 * time.Minute), nil},
+		{"replay after expiry", testClientSignature(now, "nonce-valid-000001", "input=1+1;"), models.ClientScopeJob, now.Add(10 * time.Minute), ErrSignatureExpired{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := ClientAuthenticateSignature(tt.signature, tt.scope, tt.now)
+			assert.Equal(t, tt.wantErr, err)
+			if tt.wantErr == nil {
+				assert.Equal(t, "moodle", client.Name)
+			}
+		})
+	}
+
+	// The body is not read for unknown clients and invalid headers
+	for _, update := range []func(signature *ClientSignature){
+		func(signature *ClientSignature) { signature.Client = "unknown" },
+		func(signature *ClientSignature) { signature.Nonce = "short" },
+		func(signature *ClientSignature) { signature.Timestamp = "yesterday" },
+		func(signature *ClientSignature) {
+			signature.Timestamp = strconv.FormatInt(now.Add(-time.Hour).Unix(), 10)
+		},
+	} {
+		signature := testClientSignature(now, "nonce-unread-000001", "input=1+1;")
+		update(&signature)
+		signature.Body = func() ([]byte, error) {
+			t.Error("body is read")
+			return nil, nil
+		}
+		_, err := ClientAuthenticateSignature(signature, models.ClientScopeJob, now)
+		assert.Error(t, err)
+	}
+}
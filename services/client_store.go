@@ -0,0 +1,193 @@
+/*******************************************************************************
+ * Service: client store
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"slices"
+	"time"
+)
+
+const (
+	ClientHashSHA256   = "sha256"
+	ClientHashBcrypt   = "bcrypt"
+	ClientHashArgon2id = "argon2id"
+)
+
+type ErrKeysFileMissing struct{}
+
+func (e ErrKeysFileMissing) Error() string {
+	return "no key store configured in server.keys_file"
+}
+
+type ErrClientNotFound string
+
+func (e ErrClientNotFound) Error() string {
+	return "client " + string(e) + " does not exist"
+}
+
+type ErrClientExists string
+
+func (e ErrClientExists) Error() string {
+	return "client " + string(e) + " already exists"
+}
+
+type ErrUnknownClientHash string
+
+func (e ErrUnknownClientHash) Error() string {
+	return "unknown hash algorithm " + string(e)
+}
+
+var clientStoreModified time.Time
+
+// ClientStoreList returns all clients of the key store
+func ClientStoreList() ([]models.Client, error) {
+	store, err := clientStoreRead()
+	return store.Clients, err
+}
+
+// ClientStoreCreate adds a client to the key store and returns its key, which is only stored as hash
+func ClientStoreCreate(name string, scopes []string, versions []string) (key string, err error) {
+	store, err := clientStoreRead()
+	if err != nil {
+		return
+	}
+	if slices.ContainsFunc(store.Clients, func(client models.Client) bool { return client.Name == name }) {
+		return "", ErrClientExists(name)
+	}
+
+	client := models.Client{Name: name, Scopes: scopes, Versions: versions}
+	if key, client.Key, err = clientKeyCreate(name); err != nil {
+		return
+	}
+	store.Clients = append(store.Clients, client)
+	return key, clientStoreWrite(store)
+}
+
+// ClientStoreRevoke disables a client; its entry remains to document the revocation
+func ClientStoreRevoke(name string) error {
+	return clientStoreUpdate(name, func(client *models.Client) error {
+		client.Disabled = true
+		return nil
+	})
+}
+
+// ClientStoreRotate replaces the key of a client and returns the new one
+func ClientStoreRotate(name string) (key string, err error) {
+	err = clientStoreUpdate(name, func(client *models.Client) (err error) {
+		key, client.Key, err = clientKeyCreate(name)
+		return
+	})
+	return
+}
+
+// ClientStoreReload loads the clients again if the key store was modified since the last load
+func ClientStoreReload() (reloaded bool, err error) {
+	keysFile := viper.GetString("server.keys_file")
+	if keysFile == "" {
+		return
+	}
+	var modified time.Time
+	if info, err := os.Stat(keysFile); err == nil {
+		modified = info.ModTime()
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+
+	clientMutex.RLock()
+	unchanged := modified.Equal(clientStoreModified)
+	clientMutex.RUnlock()
+	if unchanged {
+		return
+	}
+	return true, ClientLoad()
+}
+
+func clientStoreUpdate(name string, update func(client *models.Client) error) error {
+	store, err := clientStoreRead()
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(store.Clients, func(client models.Client) bool { return client.Name == name })
+	if i < 0 {
+		return ErrClientNotFound(name)
+	}
+	if err = update(&store.Clients[i]); err != nil {
+		return err
+	}
+	return clientStoreWrite(store)
+}
+
+// clientStoreRead reads the key store; a missing file is an empty store
+func clientStoreRead() (store models.ClientStore, err error) {
+	keysFile := viper.GetString("server.keys_file")
+	if keysFile == "" {
+		return store, ErrKeysFileMissing{}
+	}
+	if _, err = os.Stat(keysFile); os.IsNotExist(err) {
+		return store, nil
+	}
+
+	keys := viper.New()
+	keys.SetConfigFile(keysFile)
+	if err = keys.ReadInConfig(); err != nil {
+		return
+	}
+	err = keys.Unmarshal(&store)
+	return
+}
+
+func clientStoreWrite(store models.ClientStore) error {
+	if err := clientValidate(store.Clients); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(store)
+	if err != nil {
+		return err
+	}
+	return storageWriteFile(viper.GetString("server.keys_file"), bytes.NewReader(data), int64(len(data)), 0600)
+}
+
+// clientKeyCreate returns a random key prefixed by the client's name and its hash by `server.keys_hash`
+func clientKeyCreate(name string) (key string, hash string, err error) {
+	raw := make([]byte, 32)
+	if _, err = rand.Read(raw); err != nil {
+		return
+	}
+	key = name + clientKeySeparator + base64.RawURLEncoding.EncodeToString(raw)
+
+	switch algorithm := viper.GetString("server.keys_hash"); algorithm {
+	case ClientHashSHA256:
+		hash = clientKeyHashSHA256(key)
+	case ClientHashBcrypt:
+		var sum []byte
+		sum, err = bcrypt.GenerateFromPassword([]byte(key), bcrypt.DefaultCost)
+		hash = string(sum)
+	case ClientHashArgon2id:
+		salt := make([]byte, 16)
+		if _, err = rand.Read(salt); err != nil {
+			return
+		}
+		const memory, iterations, threads = 64 * 1024, 1, 4
+		sum := argon2.IDKey([]byte(key), salt, iterations, memory, threads, 32)
+		hash = fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, memory, iterations, threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(sum))
+	default:
+		err = ErrUnknownClientHash(algorithm)
+	}
+	return
+}
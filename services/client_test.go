@@ -0,0 +1,272 @@
+/*******************************************************************************
+ * Test: Service: client
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testArgon2idHash(key string) string {
+	salt := []byte("0123456789abcdef")
+	sum := argon2.IDKey([]byte(key), salt, 1, 8*1024, 1, 32)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, 8*1024, 1, 1,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(sum))
+}
+
+func Test_clientKeyVerify(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("secretsecretsecret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		hash      string
+		wantValid bool
+	}{
+		{"sha256", clientKeyHashSHA256("secretsecretsecret"), true},
+		{"bcrypt", string(bcryptHash), true},
+		{"argon2id", testArgon2idHash("secretsecretsecret"), true},
+		{"plain text", "secretsecretsecret", false},
+		{"short sha256", "sha256:abcd", false},
+		{"malformed argon2id", "$argon2id$v=19$m=8192$salt$hash", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantValid, clientKeyValid(tt.hash))
+			assert.Equal(t, tt.wantValid, clientKeyVerify(tt.hash, "secretsecretsecret"))
+			assert.False(t, clientKeyVerify(tt.hash, "secretsecretsecreT"))
+		})
+	}
+}
+
+func TestClientAuthenticate(t *testing.T) {
+	keysFile := path.Join(t.TempDir(), "keys.yaml")
+	require.NoError(t, os.WriteFile(keysFile, []byte(fmt.Sprintf(`clients:
+  - name: moodle-a
+    key: "%s"
+    scopes: [job]
+    versions: ["2023010400"]
+  - name: moodle-b
+    key: "%s"
+    scopes: [job, metrics]
+  - name: moodle-c
+    key: "%s"
+    scopes: [job]
+  - name: revoked
+    key: "%s"
+    scopes: [job]
+    disabled: true
+`, clientKeyHashSHA256("key-a"), testArgon2idHash("key-b"), testArgon2idHash("moodle-c.key-c"), clientKeyHashSHA256("key-revoked"))), 0600))
+
+	viper.Set("server.keys_file", keysFile)
+	viper.Set("server.api_key", "legacy-key")
+	viper.Set("server.admin.api_key", nil)
+	viper.Set("server.metrics.api_key", nil)
+	defer func() {
+		viper.Set("server.keys_file", nil)
+		viper.Set("server.api_key", nil)
+		clientList = nil
+	}()
+	require.NoError(t, ClientLoad())
+
+	tests := []struct {
+		name         string
+		username     string
+		key          string
+		scope        string
+		wantClient   string
+		wantVersions []string
+		wantOK       bool
+	}{
+		{"api key", "", "key-a", models.ClientScopeJob, "moodle-a", []string{"2023010400"}, true},
+		{"basic auth", "moodle-b", "key-b", models.ClientScopeMetrics, "moodle-b", nil, true},
+		{"basic auth of other client", "moodle-a", "key-b", models.ClientScopeJob, "", nil, false},
+		{"slow hash via header", "", "key-b", models.ClientScopeJob, "", nil, false},
+		{"slow hash via header with name", "", "moodle-c.key-c", models.ClientScopeJob, "moodle-c", nil, true},
+		{"slow hash via header with other name", "", "moodle-b.key-c", models.ClientScopeJob, "", nil, false},
+		{"missing scope", "", "key-a", models.ClientScopeMetrics, "", nil, false},
+		{"disabled", "revoked", "key-revoked", models.ClientScopeJob, "", nil, false},
+		{"legacy key", "someone", "legacy-key", models.ClientScopeJob, "someone", nil, true},
+		{"legacy key via header", "", "legacy-key", models.ClientScopeJob, "", nil, true},
+		{"wrong key", "", "key-c", models.ClientScopeJob, "", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, ok := ClientAuthenticate(tt.username, tt.key, tt.scope)
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.Equal(t, tt.wantClient, client.Name)
+				assert.Equal(t, tt.wantVersions, client.Versions)
+			}
+		})
+	}
+
+	assert.False(t, ClientScopeOpen(models.ClientScopeJob))
+	assert.False(t, ClientScopeOpen(models.ClientScopeMetrics))
+	assert.False(t, ClientScopeOpen(models.ClientScopeAdmin))
+}
+
+func Test_clientKeyVerifyCached(t *testing.T) {
+	viper.Set("server.keys_cache", time.Minute)
+	defer viper.Set("server.keys_cache", nil)
+	hash := testArgon2idHash("moodle.key")
+	cacheKey := sha256.Sum256([]byte(hash + "\nmoodle.key"))
+
+	assert.False(t, clientKeyVerifyCached(hash, "moodle.wrong"))
+	assert.True(t, clientKeyVerifyCached(hash, "moodle.key"))
+	clientKeyCacheMutex.Lock()
+	assert.Contains(t, clientKeyCache, cacheKey)
+	clientKeyCacheMutex.Unlock()
+
+	// An expired verification is repeated
+	clientKeyCacheMutex.Lock()
+	clientKeyCache[cacheKey] = time.Now().Add(-time.Second)
+	clientKeyCacheMutex.Unlock()
+	assert.True(t, clientKeyVerifyCached(hash, "moodle.key"))
+	clientKeyCacheMutex.Lock()
+	assert.True(t, time.Now().Before(clientKeyCache[cacheKey]))
+	clientKeyCacheMutex.Unlock()
+}
+
+func TestClientLoad_invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		clients string
+	}{
+		{"invalid name", `[{name: "moodle a", key: "{key}", scopes: [job]}]`},
+		{"duplicate name", `[{name: moodle, key: "{key}", scopes: [job]}, {name: moodle, key: "{key}", scopes: [job]}]`},
+		{"plain key", `[{name: moodle, key: "secretsecretsecret", scopes: [job]}]`},
+		{"missing key", `[{name: moodle, scopes: [job]}]`},
+		{"plain key with subject", `[{name: moodle, key: "secretsecretsecret", subject: moodle.example.org, scopes: [job]}]`},
+		{"unknown scope", `[{name: moodle, key: "{key}", scopes: [root]}]`},
+		{"invalid network", `[{name: moodle, key: "{key}", scopes: [job], networks: [10.0.0.0/33]}]`},
+		{"short secret", `[{name: moodle, secret: "secretsecretsecret", scopes: [job]}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keysFile := path.Join(t.TempDir(), "keys.yaml")
+			require.NoError(t, os.WriteFile(keysFile, []byte("clients: "+strings.ReplaceAll(tt.clients, "{key}", clientKeyHashSHA256("key"))), 0600))
+			viper.Set("server.keys_file", keysFile)
+			defer viper.Set("server.keys_file", nil)
+
+			assert.IsType(t, ErrClientInvalid{}, ClientLoad())
+		})
+	}
+}
+
+func TestClientStore(t *testing.T) {
+	viper.Set("server.keys_file", path.Join(t.TempDir(), "keys.yaml"))
+	viper.Set("server.api_key", nil)
+	defer func() {
+		viper.Set("server.keys_file", nil)
+		clientList = nil
+	}()
+
+	tests := []struct {
+		name      string
+		algorithm string
+	}{
+		{"sha256", ClientHashSHA256},
+		{"bcrypt", ClientHashBcrypt},
+		{"argon2id", ClientHashArgon2id},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("server.keys_hash", tt.algorithm)
+			key, err := ClientStoreCreate(tt.name, []string{models.ClientScopeJob}, []string{"4.4.2"})
+			require.NoError(t, err)
+
+			// The key store only contains the hash
+			data, err := os.ReadFile(viper.GetString("server.keys_file"))
+			require.NoError(t, err)
+			assert.NotContains(t, string(data), key)
+
+			_, err = ClientStoreReload()
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(key, tt.name+"."))
+			client, ok := ClientAuthenticate(tt.name, key, models.ClientScopeJob)
+			require.True(t, ok)
+			assert.Equal(t, []string{"4.4.2"}, client.Versions)
+			client, ok = ClientAuthenticate("", key, models.ClientScopeJob)
+			require.True(t, ok)
+			assert.Equal(t, tt.name, client.Name)
+
+			rotated, err := ClientStoreRotate(tt.name)
+			require.NoError(t, err)
+			require.NoError(t, ClientLoad())
+			_, ok = ClientAuthenticate(tt.name, key, models.ClientScopeJob)
+			assert.False(t, ok)
+			_, ok = ClientAuthenticate(tt.name, rotated, models.ClientScopeJob)
+			assert.True(t, ok)
+
+			require.NoError(t, ClientStoreRevoke(tt.name))
+			require.NoError(t, ClientLoad())
+			_, ok = ClientAuthenticate(tt.name, rotated, models.ClientScopeJob)
+			assert.False(t, ok)
+		})
+	}
+
+	viper.Set("server.keys_hash", ClientHashSHA256)
+	_, err := ClientStoreCreate("sha256", nil, nil)
+	assert.Equal(t, ErrClientExists("sha256"), err)
+	assert.Equal(t, ErrClientNotFound("unknown"), ClientStoreRevoke("unknown"))
+
+	clients, err := ClientStoreList()
+	require.NoError(t, err)
+	require.Len(t, clients, len(tests))
+	for _, client := range clients {
+		assert.True(t, client.Disabled)
+	}
+}
+
+func TestClientStoreReload(t *testing.T) {
+	viper.Set("server.keys_file", path.Join(t.TempDir(), "keys.yaml"))
+	viper.Set("server.keys_hash", ClientHashSHA256)
+	viper.Set("server.api_key", nil)
+	defer func() {
+		viper.Set("server.keys_file", nil)
+		clientList = nil
+	}()
+
+	// A missing key store is empty
+	require.NoError(t, ClientLoad())
+	reloaded, err := ClientStoreReload()
+	require.NoError(t, err)
+	assert.False(t, reloaded)
+
+	key, err := ClientStoreCreate("moodle", []string{models.ClientScopeJob}, nil)
+	require.NoError(t, err)
+	reloaded, err = ClientStoreReload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	_, ok := ClientAuthenticate("", key, models.ClientScopeJob)
+	assert.True(t, ok)
+
+	reloaded, err = ClientStoreReload()
+	require.NoError(t, err)
+	assert.False(t, reloaded)
+
+	// An invalid key store keeps the loaded clients
+	require.NoError(t, os.WriteFile(viper.GetString("server.keys_file"), []byte("clients: [{name: moodle, key: plain}]"), 0600))
+	_, err = ClientStoreReload()
+	assert.IsType(t, ErrClientInvalid{}, err)
+	_, ok = ClientAuthenticate("", key, models.ClientScopeJob)
+	assert.True(t, ok)
+}
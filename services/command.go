@@ -8,8 +8,11 @@
 package services
 
 import (
+	"Moodle_Maxima_Pool/models"
 	"context"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"io"
 	"os"
 	"os/exec"
@@ -19,32 +22,48 @@ import (
 	"time"
 )
 
-func CommandCreate(timeout time.Duration, stdIn string, command string, args ...string) (stdOut []byte, stdErr []byte, workspace string, clean func(), err error) {
+func CommandCreate(ctx context.Context, timeout time.Duration, stdIn string, command string, args ...string) (stdOut []byte, stdErr []byte, workspace string, clean func(), err error) {
+	clean = func() {}
 	uid, gid, err := commandGetUser()
 	if err != nil {
 		return
 	}
 
-	workspace, err, clean = commandCreateWorkspace(uid, gid)
+	prefix := "maxima-"
+	if id := requestIDFrom(ctx); id != "" {
+		prefix += id + "-"
+	}
+
+	_, span := Tracer().Start(ctx, "workspace.create")
+	workspace, err, clean = commandCreateWorkspace(prefix, uid, gid)
+	tracingEnd(span, err)
 	if err != nil {
 		return
 	}
+	jobUpdate(ctx, func(info *models.JobInfo) {
+		info.Workspace = workspace
+	})
 
-	stdOut, stdErr, err = commandRun(timeout, uid, gid, workspace, stdIn, command, args...)
+	stdOut, stdErr, err = commandRun(ctx, timeout, uid, gid, workspace, stdIn, command, args...)
 	return
 }
 
-func commandRun(timeout time.Duration, uid int64, gid int64, workspace string, stdIn string, command string, args ...string) (stdOut []byte, stdErr []byte, err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+func commandRun(ctx context.Context, timeout time.Duration, uid int64, gid int64, workspace string, stdIn string, command string, args ...string) (stdOut []byte, stdErr []byte, err error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	// Create command context
 	cmdCtx := exec.CommandContext(ctx, command, args...)
 	cmdCtx.Dir = workspace
 
+	// Own process group to terminate all children of Maxima, e.g. gnuplot
+	cmdCtx.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmdCtx.Cancel = func() error {
+		return syscall.Kill(-cmdCtx.Process.Pid, syscall.SIGKILL)
+	}
+
 	// User credentials
 	if uid >= 0 {
-		cmdCtx.SysProcAttr = &syscall.SysProcAttr{}
 		cmdCtx.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
 	}
 
@@ -65,9 +84,29 @@ func commandRun(timeout time.Duration, uid int64, gid int64, workspace string, s
 	}
 
 	// Start command
-	if err = cmdCtx.Start(); err != nil {
+	_, span := Tracer().Start(ctx, "process.start", trace.WithAttributes(attribute.String("process.command", command)))
+	err = cmdCtx.Start()
+	if err == nil {
+		span.SetAttributes(attribute.Int("process.pid", cmdCtx.Process.Pid))
+		jobUpdate(ctx, func(info *models.JobInfo) {
+			info.PID = cmdCtx.Process.Pid
+		})
+	}
+	tracingEnd(span, err)
+	if err != nil {
 		return
 	}
+	metricProcesses.Inc()
+	defer metricProcesses.Dec()
+
+	_, span = Tracer().Start(ctx, "process.output")
+	defer func() {
+		attributes := []attribute.KeyValue{attribute.Int("process.stdout_size", len(stdOut))}
+		if cmdCtx.ProcessState != nil {
+			attributes = append(attributes, attribute.Int("process.exit_code", cmdCtx.ProcessState.ExitCode()))
+		}
+		tracingEnd(span, err, attributes...)
+	}()
 
 	// I/O interaction
 	if _, err = stdInWriter.Write([]byte(stdIn)); err != nil {
@@ -89,6 +128,9 @@ func commandRun(timeout time.Duration, uid int64, gid int64, workspace string, s
 
 	// Process handling
 	errCmd := cmdCtx.Wait()
+	if cmdCtx.ProcessState != nil {
+		jobAccount(ctx, cmdCtx.ProcessState.UserTime()+cmdCtx.ProcessState.SystemTime())
+	}
 	if err = ctx.Err(); err != nil {
 		return
 	}
@@ -113,13 +155,19 @@ func commandGetUser() (uid int64, gid int64, err error) {
 	return
 }
 
-func commandCreateWorkspace(uid int64, gid int64) (workspace string, err error, clean func()) {
+func commandCreateWorkspace(prefix string, uid int64, gid int64) (workspace string, err error, clean func()) {
 	clean = func() {}
-	if workspace, err = os.MkdirTemp(viper.GetString("storage.workspace"), "maxima-"); err != nil {
+	if workspace, err = os.MkdirTemp(viper.GetString("storage.workspace"), prefix); err != nil {
 		return
 	}
 	clean = func() {
 		_ = os.RemoveAll(workspace)
+		_ = os.Remove(workspace + WorkspaceMarkerSuffix)
+	}
+
+	// The marker beside the workspace is out of reach of the job and tells the janitor it is ours
+	if err = os.WriteFile(workspace+WorkspaceMarkerSuffix, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+		return
 	}
 
 	if uid >= 0 {
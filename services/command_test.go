@@ -8,6 +8,7 @@
 package services
 
 import (
+	"context"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -49,7 +50,7 @@ func Test_commandCreateWorkspace(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			viper.Set("storage.workspace", tt.setWorkspace)
-			gotWorkspace, gotErr, gotClean := commandCreateWorkspace(tt.args.uid, tt.args.gid)
+			gotWorkspace, gotErr, gotClean := commandCreateWorkspace("maxima-", tt.args.uid, tt.args.gid)
 
 			if tt.wantErr != nil {
 				assert.Error(t, gotErr)
@@ -57,6 +58,7 @@ func Test_commandCreateWorkspace(t *testing.T) {
 			} else {
 				assert.NoError(t, gotErr)
 				assert.DirExists(t, gotWorkspace)
+				assert.FileExists(t, gotWorkspace+WorkspaceMarkerSuffix)
 
 				info, err := os.Stat(gotWorkspace)
 				require.NoError(t, err)
@@ -68,6 +70,7 @@ func Test_commandCreateWorkspace(t *testing.T) {
 
 			gotClean()
 			assert.NoDirExists(t, gotWorkspace)
+			assert.NoFileExists(t, gotWorkspace+WorkspaceMarkerSuffix)
 		})
 	}
 }
@@ -154,7 +157,7 @@ func TestCommandCreate(t *testing.T) {
 		}
 
 		t.Run(tt.name, func(t *testing.T) {
-			gotStdOut, gotStdErr, _, _, gotErr := CommandCreate(tt.args.timeout, tt.args.stdIn, tt.args.command, tt.args.args...)
+			gotStdOut, gotStdErr, _, _, gotErr := CommandCreate(context.Background(), tt.args.timeout, tt.args.stdIn, tt.args.command, tt.args.args...)
 			assert.Equal(t, tt.wantErr, gotErr != nil)
 			assert.Equal(t, tt.wantStdOut, gotStdOut)
 			assert.Equal(t, tt.wantStdErr, gotStdErr)
@@ -0,0 +1,94 @@
+/*******************************************************************************
+ * Service: drain
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"github.com/spf13/viper"
+	"sync"
+	"time"
+)
+
+type ErrDraining struct{}
+
+func (e ErrDraining) Error() string {
+	return "the pool is draining and does not accept jobs"
+}
+
+const drainPollInterval = 50 * time.Millisecond
+
+var (
+	drainSince *time.Time
+	drainMutex sync.Mutex
+)
+
+// DrainStart stops the admission of jobs
+func DrainStart() {
+	drainMutex.Lock()
+	defer drainMutex.Unlock()
+	if drainSince == nil {
+		now := time.Now()
+		drainSince = &now
+	}
+}
+
+// Drain stops the admission of jobs, waits up to `server.drain_timeout` for running jobs and kills the remaining
+// ones. It returns once all jobs are gone or the drain is stopped by DrainStop.
+func Drain() {
+	DrainStart()
+
+	drainMutex.Lock()
+	since := drainSince
+	drainMutex.Unlock()
+
+	deadline := since.Add(viper.GetDuration("server.drain_timeout"))
+	for drainWaiting(since) {
+		if time.Now().After(deadline) {
+			for _, info := range JobList() {
+				_ = JobKill(info.ID)
+			}
+		}
+		time.Sleep(drainPollInterval)
+	}
+}
+
+// drainWaiting is true while jobs are running and the drain which started at since is still active
+func drainWaiting(since *time.Time) bool {
+	drainMutex.Lock()
+	active := drainSince == since
+	drainMutex.Unlock()
+
+	jobRegistryMutex.Lock()
+	defer jobRegistryMutex.Unlock()
+	return active && len(jobRegistry) > 0
+}
+
+// DrainStop accepts jobs again
+func DrainStop() {
+	drainMutex.Lock()
+	defer drainMutex.Unlock()
+	drainSince = nil
+}
+
+// Draining is true if the admission of jobs is stopped
+func Draining() bool {
+	drainMutex.Lock()
+	defer drainMutex.Unlock()
+	return drainSince != nil
+}
+
+func DrainState() models.DrainState {
+	drainMutex.Lock()
+	state := models.DrainState{Draining: drainSince != nil, Since: drainSince}
+	drainMutex.Unlock()
+
+	jobRegistryMutex.Lock()
+	defer jobRegistryMutex.Unlock()
+	state.Jobs = len(jobRegistry)
+	return state
+}
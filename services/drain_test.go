@@ -0,0 +1,92 @@
+/*******************************************************************************
+ * Test: Service: drain
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"context"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	viper.Set("job.user", nil)
+	viper.Set("job.timeout", 10*time.Second)
+	viper.Set("job.concurrency", 0)
+	viper.Set("storage.backend", "local")
+	viper.Set("storage.workspace", t.TempDir())
+	viper.Set("storage.data", t.TempDir())
+	maximaSnapshotList = models.MaximaSnapshotList{{Version: "2023010400", Healthy: true}, {Version: "2024010100", Healthy: true}}
+	jobSlots = nil
+	defer func() {
+		DrainStop()
+		maximaSnapshotList = nil
+		jobSlots = nil
+	}()
+	createTestSnapshot(t, "2023010400", "cat > /dev/null; sleep 0.3; echo OUTPUT")
+	createTestSnapshot(t, "2024010100", "cat > /dev/null; exec sleep 30")
+
+	tests := []struct {
+		name        string
+		timeout     time.Duration
+		version     string
+		wantOutcome string
+	}{
+		{"finished", 5 * time.Second, "2023010400", models.JobOutcomeOK},
+		{"killed", 100 * time.Millisecond, "2024010100", models.JobOutcomeKilled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("server.drain_timeout", tt.timeout)
+			DrainStop()
+
+			done := make(chan *models.JobResponse)
+			go func() {
+				resp, _ := JobCreate(context.Background(), &models.JobRequestQuery{Input: "1+1;", Timeout: 10000, Version: tt.version})
+				done <- resp
+			}()
+			require.Eventually(t, func() bool {
+				jobs := JobList()
+				return len(jobs) == 1 && jobs[0].PID != 0
+			}, 5*time.Second, 10*time.Millisecond)
+
+			drained := make(chan struct{})
+			go func() {
+				Drain()
+				close(drained)
+			}()
+
+			// New jobs are rejected while draining
+			require.Eventually(t, Draining, time.Second, time.Millisecond)
+			resp, err := JobCreate(context.Background(), &models.JobRequestQuery{Input: "1+1;", Timeout: 10000})
+			assert.Equal(t, ErrDraining{}, err)
+			assert.Equal(t, models.JobOutcomeRejected, resp.Outcome)
+			assert.Equal(t, models.HealthStatusFail, Health().Checks["drain"].Status)
+
+			select {
+			case <-drained:
+			case <-time.After(5 * time.Second):
+				t.Fatal("drain did not finish")
+			}
+			assert.Equal(t, tt.wantOutcome, (<-done).Outcome)
+			assert.Equal(t, models.DrainState{Draining: true, Since: DrainState().Since, Jobs: 0}, DrainState())
+
+			// Workspaces are cleaned up
+			entries, err := os.ReadDir(viper.GetString("storage.workspace"))
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+
+	DrainStop()
+	assert.False(t, DrainState().Draining)
+}
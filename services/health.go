@@ -0,0 +1,168 @@
+/*******************************************************************************
+ * Service: health
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type ErrInsufficientSpace uint64
+
+func (e ErrInsufficientSpace) Error() string {
+	return fmt.Sprintf("workspace has only %d MiB of free space", uint64(e)>>20)
+}
+
+type ErrQueueSaturated int
+
+func (e ErrQueueSaturated) Error() string {
+	return fmt.Sprintf("%d jobs are waiting for a free slot", int(e))
+}
+
+var (
+	healthProbes      map[string]models.HealthCheck
+	healthProbesMutex sync.RWMutex
+)
+
+// HealthProbe evaluates `health.probe.input` with the snapshots of the `health.probe.versions` newest versions (or
+// all if it is zero) and caches the results for Health
+func HealthProbe() {
+	test := MaximaSnapshotTest{Input: viper.GetString("health.probe.input"), Expected: viper.GetString("health.probe.expected")}
+
+	probes := make(map[string]models.HealthCheck)
+	for _, stackVersion := range healthProbeVersions(viper.GetInt("health.probe.versions")) {
+		probes[stackVersion] = healthCheck("", maximaSnapshotRunTest(stackVersion, test))
+	}
+
+	healthProbesMutex.Lock()
+	defer healthProbesMutex.Unlock()
+	healthProbes = probes
+}
+
+// healthProbeVersions returns up to limit versions of usable snapshots, newest first
+func healthProbeVersions(limit int) (versions []string) {
+	maximaSnapshotLoad()
+
+	maximaSnapshotMutex.RLock()
+	defer maximaSnapshotMutex.RUnlock()
+
+	force := viper.GetBool("maxima.validation.force")
+	for i := len(maximaSnapshotList) - 1; i >= 0 && (limit <= 0 || len(versions) < limit); i-- {
+		if maximaSnapshotList[i].Usable(force) {
+			versions = append(versions, maximaSnapshotList[i].Version)
+		}
+	}
+	return
+}
+
+// Health evaluates the cheap checks and adds the cached results of the last HealthProbe
+func Health() *models.HealthResponse {
+	resp := &models.HealthResponse{Status: models.HealthStatusOK, Checks: make(map[string]models.HealthCheck)}
+
+	resp.Checks["snapshots"] = healthCheck(healthSnapshots())
+	resp.Checks["workspace"] = healthCheck(healthWorkspace())
+	resp.Checks["job_user"] = healthCheck(healthJobUser())
+	resp.Checks["gnuplot"] = healthCheck(exec.LookPath("gnuplot"))
+	resp.Checks["queue"] = healthCheck(healthQueue())
+	resp.Checks["drain"] = healthCheck(healthDrain())
+
+	if viper.GetDuration("health.interval") > 0 {
+		healthProbesMutex.RLock()
+		if healthProbes == nil {
+			resp.Checks["maxima"] = models.HealthCheck{Status: models.HealthStatusPending, Details: "probe has not run yet", Checked: time.Now()}
+		}
+		for stackVersion, check := range healthProbes {
+			resp.Checks["maxima-"+stackVersion] = check
+		}
+		healthProbesMutex.RUnlock()
+	}
+
+	for _, check := range resp.Checks {
+		if check.Status != models.HealthStatusOK {
+			resp.Status = models.HealthStatusFail
+		}
+	}
+	return resp
+}
+
+func healthCheck(details string, err error) models.HealthCheck {
+	if err != nil {
+		return models.HealthCheck{Status: models.HealthStatusFail, Details: err.Error(), Checked: time.Now()}
+	}
+	return models.HealthCheck{Status: models.HealthStatusOK, Details: details, Checked: time.Now()}
+}
+
+func healthSnapshots() (string, error) {
+	stackVersion, err := MaximaSnapshotGet("")
+	if err != nil {
+		return "", err
+	}
+	return "default version " + stackVersion, nil
+}
+
+// healthWorkspace checks whether a file can be written into the workspace and enough space is left
+func healthWorkspace() (string, error) {
+	workspace := viper.GetString("storage.workspace")
+
+	file, err := os.CreateTemp(workspace, ".health-")
+	if err != nil {
+		return "", err
+	}
+	_, err = file.WriteString("1+1;")
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	if errRemove := os.Remove(file.Name()); err == nil {
+		err = errRemove
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var stat syscall.Statfs_t
+	if err = syscall.Statfs(workspace, &stat); err != nil {
+		return "", err
+	}
+	free := stat.Bavail * uint64(stat.Bsize)
+	if free < uint64(viper.GetInt64("health.min_free_space"))<<20 {
+		return "", ErrInsufficientSpace(free)
+	}
+	return fmt.Sprintf("%d MiB free", free>>20), nil
+}
+
+func healthJobUser() (string, error) {
+	uid, _, err := commandGetUser()
+	if err != nil || uid < 0 {
+		return "", err
+	}
+	return fmt.Sprintf("uid %d", uid), nil
+}
+
+func healthQueue() (string, error) {
+	running, waiting, capacity := JobQueueState()
+	if maxQueued := viper.GetInt("health.max_queued"); maxQueued > 0 && waiting >= maxQueued {
+		return "", ErrQueueSaturated(waiting)
+	}
+	if capacity == 0 {
+		return fmt.Sprintf("%d waiting, no limit", waiting), nil
+	}
+	return fmt.Sprintf("%d/%d running, %d waiting", running, capacity, waiting), nil
+}
+
+func healthDrain() (string, error) {
+	if Draining() {
+		return "", ErrDraining{}
+	}
+	return "", nil
+}
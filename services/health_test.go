@@ -0,0 +1,114 @@
+/*******************************************************************************
+ * Test: Service: health
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"context"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	viper.Set("job.user", nil)
+	viper.Set("job.timeout", time.Second)
+	viper.Set("job.concurrency", 1)
+	viper.Set("storage.backend", "local")
+	viper.Set("storage.workspace", t.TempDir())
+	viper.Set("storage.data", t.TempDir())
+	viper.Set("health.interval", time.Minute)
+	viper.Set("health.probe.input", "1+1;")
+	viper.Set("health.probe.expected", `\b2\b`)
+	viper.Set("health.probe.versions", 1)
+	viper.Set("health.min_free_space", 0)
+	viper.Set("health.max_queued", 1)
+	defer func() {
+		maximaSnapshotList = nil
+		healthProbes = nil
+		jobSlots = nil
+	}()
+
+	// Fake gnuplot in PATH
+	bin := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(bin, "gnuplot"), []byte("#!/bin/sh\n"), 0755))
+	t.Setenv("PATH", bin+":"+os.Getenv("PATH"))
+
+	tests := []struct {
+		name       string
+		snapshots  models.MaximaSnapshotList
+		script     string
+		probe      bool
+		waiting    bool
+		wantStatus string
+		wantChecks map[string]string
+	}{
+		{"ready", models.MaximaSnapshotList{{Version: "2023010400", Healthy: true}, {Version: "2023121100", Healthy: true}}, `cat > /dev/null; echo "(%o1) 2"`, true, false, models.HealthStatusOK,
+			map[string]string{"snapshots": models.HealthStatusOK, "maxima-2023121100": models.HealthStatusOK, "gnuplot": models.HealthStatusOK}},
+		{"probe pending", models.MaximaSnapshotList{{Version: "2023121100", Healthy: true}}, `cat > /dev/null; echo "(%o1) 2"`, false, false, models.HealthStatusFail,
+			map[string]string{"maxima": models.HealthStatusPending}},
+		{"probe failed", models.MaximaSnapshotList{{Version: "2023121100", Healthy: true}}, "exit 139", true, false, models.HealthStatusFail,
+			map[string]string{"maxima-2023121100": models.HealthStatusFail}},
+		{"no snapshots", models.MaximaSnapshotList{{Version: "2023121100", Healthy: false}}, "", true, false, models.HealthStatusFail,
+			map[string]string{"snapshots": models.HealthStatusFail}},
+		{"queue saturated", models.MaximaSnapshotList{{Version: "2023121100", Healthy: true}}, `cat > /dev/null; echo "(%o1) 2"`, true, true, models.HealthStatusFail,
+			map[string]string{"queue": models.HealthStatusFail, "maxima-2023121100": models.HealthStatusOK}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maximaSnapshotList = tt.snapshots
+			healthProbes = nil
+			jobSlots = nil
+			for _, item := range tt.snapshots {
+				createTestSnapshot(t, item.Version, tt.script)
+			}
+			if tt.probe {
+				HealthProbe()
+			}
+
+			if tt.waiting {
+				release, err := jobQueueAcquire(context.Background(), "", models.JobPriorityNormal)
+				require.NoError(t, err)
+				defer release()
+
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				go func() {
+					_, _ = jobQueueAcquire(ctx, "", models.JobPriorityNormal)
+				}()
+				require.Eventually(t, func() bool {
+					_, waiting, _ := JobQueueState()
+					return waiting == 1
+				}, time.Second, 10*time.Millisecond)
+			}
+
+			got := Health()
+			assert.Equal(t, tt.wantStatus, got.Status)
+			assert.Equal(t, models.HealthStatusOK, got.Checks["workspace"].Status)
+			for name, status := range tt.wantChecks {
+				assert.Equal(t, status, got.Checks[name].Status, name)
+			}
+		})
+	}
+}
+
+func Test_healthWorkspace(t *testing.T) {
+	viper.Set("storage.workspace", path.Join(t.TempDir(), "missing"))
+	viper.Set("health.min_free_space", 0)
+	_, err := healthWorkspace()
+	assert.Error(t, err)
+
+	viper.Set("storage.workspace", t.TempDir())
+	viper.Set("health.min_free_space", 1<<40)
+	_, err = healthWorkspace()
+	assert.ErrorAs(t, err, new(ErrInsufficientSpace))
+}
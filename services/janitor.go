@@ -0,0 +1,201 @@
+/*******************************************************************************
+ * Service: janitor
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"errors"
+	"github.com/spf13/viper"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// WorkspaceMarkerSuffix is appended to the path of a workspace to mark it as created by the pool
+const WorkspaceMarkerSuffix = ".maxima-pool"
+
+type JanitorReport struct {
+	Workspaces []string
+	Processes  []int
+}
+
+// Janitor removes workspaces older than `storage.janitor.max_age` and kills processes of snapshots which do not belong
+// to this server, e.g. after a crash. Workspaces and processes of another server or command which is still running
+// are left alone. Both run even if the other one fails.
+func Janitor() (report JanitorReport, err error) {
+	var errProcesses, errWorkspaces error
+	report.Processes, errProcesses = janitorProcesses("/proc")
+	report.Workspaces, errWorkspaces = janitorWorkspaces(viper.GetString("storage.workspace"), viper.GetDuration("storage.janitor.max_age"))
+	return report, errors.Join(errProcesses, errWorkspaces)
+}
+
+// janitorWorkspaces removes all marked workspaces older than maxAge, except those of running jobs and running owners
+func janitorWorkspaces(root string, maxAge time.Duration) (removed []string, err error) {
+	markers, err := filepath.Glob(path.Join(root, "*"+WorkspaceMarkerSuffix))
+	if err != nil {
+		return
+	}
+
+	active := make(map[string]bool)
+	for _, info := range JobList() {
+		active[info.Workspace] = true
+	}
+
+	for _, marker := range markers {
+		info, err := os.Stat(marker)
+		if err != nil || !info.Mode().IsRegular() || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+
+		workspace := strings.TrimSuffix(marker, WorkspaceMarkerSuffix)
+		if active[workspace] || janitorOwnerAlive(marker) {
+			continue
+		}
+		if err = os.RemoveAll(workspace); err != nil {
+			return removed, err
+		}
+		if err = os.Remove(marker); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return removed, err
+		}
+		removed = append(removed, workspace)
+	}
+	return
+}
+
+type janitorProcess struct {
+	pid  int
+	ppid int
+	pgid int
+	uid  int
+	exe  string
+	cwd  string
+}
+
+// janitorProcesses kills all processes of snapshot executables running as `job.user`, which are not in the process
+// group of a child of this server and whose workspace does not belong to another running owner
+func janitorProcesses(proc string) (killed []int, err error) {
+	uid := os.Getuid()
+	if userID, _, errUser := commandGetUser(); errUser != nil {
+		return nil, errUser
+	} else if userID >= 0 {
+		uid = int(userID)
+	}
+
+	// One listing, so processes started in the meantime are not considered at all
+	entries, err := os.ReadDir(proc)
+	if err != nil {
+		return
+	}
+	var processes []janitorProcess
+	children := make(map[int]bool)
+	for _, entry := range entries {
+		pid, errAtoi := strconv.Atoi(entry.Name())
+		if errAtoi != nil {
+			continue
+		}
+		process, ok := janitorReadProcess(proc, pid)
+		if !ok {
+			continue
+		}
+		if process.ppid == os.Getpid() {
+			children[process.pid] = true
+		}
+		processes = append(processes, process)
+	}
+
+	snapshots, err := filepath.Abs(viper.GetString("storage.data"))
+	if err != nil {
+		return
+	}
+	ownGroup := syscall.Getpgrp()
+	for _, process := range processes {
+		if process.uid != uid || path.Dir(process.exe) != snapshots || !strings.HasPrefix(path.Base(process.exe), "maxima-") {
+			continue
+		}
+		if children[process.pgid] || children[process.pid] || process.pgid == ownGroup {
+			continue
+		}
+		if process.cwd != "" && janitorOwnerAlive(process.cwd+WorkspaceMarkerSuffix) {
+			continue
+		}
+
+		// Processes of former releases share the group of their server
+		target := process.pid
+		if process.pgid == process.pid {
+			target = -process.pgid
+		}
+		if errKill := syscall.Kill(target, syscall.SIGKILL); errKill == nil {
+			killed = append(killed, process.pid)
+		}
+	}
+	return
+}
+
+func janitorReadProcess(proc string, pid int) (process janitorProcess, ok bool) {
+	process.pid = pid
+
+	// The name in parentheses may contain spaces
+	stat, err := os.ReadFile(path.Join(proc, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return
+	}
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	if len(fields) < 3 {
+		return
+	}
+	if process.ppid, err = strconv.Atoi(fields[1]); err != nil {
+		return
+	}
+	if process.pgid, err = strconv.Atoi(fields[2]); err != nil {
+		return
+	}
+
+	status, err := os.ReadFile(path.Join(proc, strconv.Itoa(pid), "status"))
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if uidFields := strings.Fields(line); len(uidFields) > 1 && uidFields[0] == "Uid:" {
+			if process.uid, err = strconv.Atoi(uidFields[1]); err != nil {
+				return
+			}
+		}
+	}
+
+	// Replaced snapshots are marked as deleted
+	exe, err := os.Readlink(path.Join(proc, strconv.Itoa(pid), "exe"))
+	if err != nil {
+		return
+	}
+	process.exe = strings.TrimSuffix(exe, " (deleted)")
+
+	// Jobs run in their workspace, which is unknown for processes of other users
+	if cwd, err := os.Readlink(path.Join(proc, strconv.Itoa(pid), "cwd")); err == nil {
+		process.cwd = strings.TrimSuffix(cwd, " (deleted)")
+	}
+	return process, true
+}
+
+// janitorOwnerAlive is true if the marker names another process than this server, which is still running. Markers of
+// former releases have no owner.
+func janitorOwnerAlive(marker string) bool {
+	data, err := os.ReadFile(marker)
+	if err != nil {
+		return false
+	}
+	owner, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || owner <= 0 || owner == os.Getpid() {
+		return false
+	}
+	err = syscall.Kill(owner, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
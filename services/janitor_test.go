@@ -0,0 +1,169 @@
+/*******************************************************************************
+ * Test: Service: janitor
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func Test_janitorWorkspaces(t *testing.T) {
+	root := t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+
+	createWorkspace := func(name string, marked bool, modTime time.Time, owner int) string {
+		workspace := path.Join(root, name)
+		require.NoError(t, os.MkdirAll(path.Join(workspace, "plots"), 0755))
+		require.NoError(t, os.WriteFile(path.Join(workspace, "plots", "plot.svg"), nil, 0644))
+		if marked {
+			require.NoError(t, os.WriteFile(workspace+WorkspaceMarkerSuffix, []byte(strconv.Itoa(owner)), 0644))
+			require.NoError(t, os.Chtimes(workspace+WorkspaceMarkerSuffix, modTime, modTime))
+		}
+		return workspace
+	}
+	// Another server or command, which is still running
+	owner := exec.Command("sleep", "30")
+	require.NoError(t, owner.Start())
+	defer func() {
+		_ = owner.Process.Kill()
+		_ = owner.Wait()
+	}()
+
+	stale := createWorkspace("maxima-stale", true, old, os.Getpid())
+	legacy := createWorkspace("maxima-legacy", true, old, 0)
+	fresh := createWorkspace("maxima-fresh", true, time.Now(), os.Getpid())
+	unmarked := createWorkspace("maxima-unrelated", false, old, 0)
+	running := createWorkspace("maxima-running", true, old, os.Getpid())
+	ownerAlive := createWorkspace("maxima-owner-alive", true, old, owner.Process.Pid)
+
+	jobRegistryMutex.Lock()
+	jobRegistry["running"] = &jobHandle{info: models.JobInfo{ID: "running", Workspace: running}}
+	jobRegistryMutex.Unlock()
+	defer func() {
+		jobRegistryMutex.Lock()
+		delete(jobRegistry, "running")
+		jobRegistryMutex.Unlock()
+	}()
+
+	removed, err := janitorWorkspaces(root, time.Hour)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{stale, legacy}, removed)
+	assert.NoDirExists(t, stale)
+	assert.NoFileExists(t, stale+WorkspaceMarkerSuffix)
+	assert.NoDirExists(t, legacy)
+	assert.DirExists(t, fresh)
+	assert.DirExists(t, unmarked)
+	assert.DirExists(t, running)
+	assert.DirExists(t, ownerAlive)
+}
+
+func Test_janitorProcesses(t *testing.T) {
+	viper.Set("job.user", nil)
+	viper.Set("storage.data", t.TempDir())
+
+	// The executable of the snapshot has to be a binary, since scripts show their interpreter as executable
+	sleep, err := exec.LookPath("sleep")
+	require.NoError(t, err)
+	snapshot := path.Join(viper.GetString("storage.data"), "maxima-2023010400")
+	copyFile(t, sleep, snapshot)
+
+	// A job of this server in its own process group
+	child := exec.Command(snapshot, "30")
+	child.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	require.NoError(t, child.Start())
+	defer func() {
+		_ = child.Process.Kill()
+		_ = child.Wait()
+	}()
+
+	// An orphan, whose parent has already exited
+	parent := exec.Command("sh", "-c", snapshot+" 30 > /dev/null 2>&1 & echo $!")
+	parent.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	output, err := parent.Output()
+	require.NoError(t, err)
+	orphan, err := strconv.Atoi(strings.TrimSpace(string(output)))
+	require.NoError(t, err)
+	defer func() {
+		_ = syscall.Kill(orphan, syscall.SIGKILL)
+	}()
+
+	// An orphan in the workspace of another server or command, which is still running
+	owner := exec.Command("sleep", "30")
+	require.NoError(t, owner.Start())
+	defer func() {
+		_ = owner.Process.Kill()
+		_ = owner.Wait()
+	}()
+	workspace := path.Join(t.TempDir(), "maxima-owner-alive")
+	require.NoError(t, os.Mkdir(workspace, 0755))
+	require.NoError(t, os.WriteFile(workspace+WorkspaceMarkerSuffix, []byte(strconv.Itoa(owner.Process.Pid)), 0644))
+	parent = exec.Command("sh", "-c", snapshot+" 30 > /dev/null 2>&1 & echo $!")
+	parent.Dir = workspace
+	parent.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	output, err = parent.Output()
+	require.NoError(t, err)
+	ownerAlive, err := strconv.Atoi(strings.TrimSpace(string(output)))
+	require.NoError(t, err)
+	defer func() {
+		_ = syscall.Kill(ownerAlive, syscall.SIGKILL)
+	}()
+
+	killed, err := janitorProcesses("/proc")
+	require.NoError(t, err)
+	assert.Equal(t, []int{orphan}, killed)
+	assert.NoError(t, syscall.Kill(ownerAlive, 0))
+
+	require.Eventually(t, func() bool {
+		stat, err := os.ReadFile(path.Join("/proc", strconv.Itoa(orphan), "stat"))
+		return err != nil || strings.Contains(string(stat), ") Z ")
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NoError(t, syscall.Kill(child.Process.Pid, 0))
+}
+
+func copyFile(t *testing.T, src string, dst string) {
+	in, err := os.Open(src)
+	require.NoError(t, err)
+	defer func() {
+		_ = in.Close()
+	}()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY, 0755)
+	require.NoError(t, err)
+	_, err = io.Copy(out, in)
+	require.NoError(t, err)
+	require.NoError(t, out.Close())
+}
+
+func TestJanitor(t *testing.T) {
+	viper.Set("job.user", "unknown-maxima-pool-user")
+	viper.Set("storage.workspace", t.TempDir())
+	viper.Set("storage.janitor.max_age", time.Hour)
+	defer viper.Set("job.user", nil)
+
+	// Stale workspaces are removed even if processes cannot be checked
+	old := time.Now().Add(-2 * time.Hour)
+	stale := path.Join(viper.GetString("storage.workspace"), "maxima-stale")
+	require.NoError(t, os.MkdirAll(stale, 0755))
+	require.NoError(t, os.WriteFile(stale+WorkspaceMarkerSuffix, nil, 0644))
+	require.NoError(t, os.Chtimes(stale+WorkspaceMarkerSuffix, old, old))
+
+	report, err := Janitor()
+	assert.Error(t, err)
+	assert.Equal(t, []string{stale}, report.Workspaces)
+	assert.NoDirExists(t, stale)
+}
@@ -11,37 +11,150 @@ import (
 	"Moodle_Maxima_Pool/models"
 	"archive/zip"
 	"bytes"
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"io"
 	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"time"
 )
 
-func JobCreate(data *models.JobRequestQuery) (resp *models.JobResponse, err error) {
+func JobCreate(ctx context.Context, data *models.JobRequestQuery) (resp *models.JobResponse, err error) {
 	resp = &models.JobResponse{
 		Output: new(bytes.Buffer),
 	}
 
-	version, err := MaximaSnapshotGet(data.Version)
+	ctx, handle, unregister, err := jobRegister(ctx, data)
+	defer unregister()
+
+	ctx, span := Tracer().Start(ctx, "job", trace.WithAttributes(attribute.Int("job.input_size", len(data.Input)), attribute.String("client.address", data.ClientIP)))
+
+	// Anonymous clients and clients of a shared key, whose name is the username chosen by the request, are limited and
+	// queued by their address
+	limitKey := data.Client
+	if limitKey == "" || data.SharedKey {
+		limitKey = data.ClientIP
+	}
+
+	var errCommand error
+	defer func() {
+		if handle != nil && handle.jobKilled() {
+			err = ErrJobKilled(handle.info.ID)
+		}
+		jobObserve(resp, err, errCommand)
+		tracingEnd(span, err,
+			attribute.String("maxima.version", resp.Version),
+			attribute.Int("job.plots", resp.Plots),
+			attribute.String("job.outcome", resp.Outcome),
+		)
+	}()
+
 	if err != nil {
 		return
 	}
+	if err = clientLimitAdmit(limitKey, time.Now()); err != nil {
+		return
+	}
+
+	// Requested priorities are clamped to the max priority of the client
+	limits := clientLimitsFor(limitKey)
+	resp.Priority = cmp.Or(data.Priority, limits.Priority)
+	if slices.Index(models.JobPriorities, resp.Priority) > slices.Index(models.JobPriorities, limits.MaxPriority) {
+		resp.Priority = limits.MaxPriority
+	}
+	span.SetAttributes(attribute.String("job.priority", resp.Priority))
+	jobUpdate(ctx, func(info *models.JobInfo) {
+		info.Priority = resp.Priority
+	})
+
+	// Forbidden versions are rejected before they wait for a slot
+	_, spanSnapshot := Tracer().Start(ctx, "snapshot.resolve", trace.WithAttributes(attribute.String("maxima.version.requested", data.Version)))
+	version, err := maximaSnapshotGetAllowed(data.Version, data.Versions)
+	tracingEnd(spanSnapshot, err, attribute.String("maxima.version", version))
+	if err != nil {
+		return
+	}
+	if !clientAllowsVersion(data.Versions, version) {
+		return resp, ErrVersionForbidden(version)
+	}
+	maximaSnapshotUsageRecord(version)
+	resp.Version = version
+	jobUpdate(ctx, func(info *models.JobInfo) {
+		info.Version = version
+	})
 
-	stdOut, _, workspace, clean, err := CommandCreate(
+	release, err := jobQueueAcquire(ctx, limitKey, resp.Priority)
+	if err != nil {
+		return
+	}
+	defer release()
+
+	command, err := MaximaSnapshotPath(version)
+	if err != nil {
+		return
+	}
+
+	stdIn := fmt.Sprintf(`maxima_tempdir:getcurrentdirectory()$ IMAGE_DIR:getcurrentdirectory()$ URL_BASE:"%s"$\n%s`, data.PlotURLBase, data.Input)
+	if viper.GetBool("job.expose_request_id") && data.RequestID != "" {
+		stdIn = fmt.Sprintf(`POOL_REQUEST_ID:"%s"$ `, data.RequestID) + stdIn
+	}
+
+	start := time.Now()
+	stdOut, _, workspace, clean, errCommand := CommandCreate(
+		withRequestID(ctx, data.RequestID),
 		minDuration(viper.GetDuration("job.timeout"), time.Duration(data.Timeout)*time.Millisecond),
-		fmt.Sprintf(`maxima_tempdir:getcurrentdirectory()$ IMAGE_DIR:getcurrentdirectory()$ URL_BASE:"%s"$\n%s`, data.PlotURLBase, data.Input),
-		path.Join(viper.GetString("storage.data"), "maxima-"+version),
+		stdIn,
+		command,
 		"--quiet",
 	)
+	resp.Duration = time.Since(start)
+	resp.CPUTime = handle.jobCPUTime()
+	clientLimitRecord(limitKey, time.Now(), resp.Duration, resp.CPUTime)
 	defer clean()
+
+	_, spanResponse := Tracer().Start(ctx, "output.package")
 	err = jobResponse(resp, workspace, stdOut)
+	tracingEnd(spanResponse, err, attribute.Bool("job.zip", resp.IsZIP), attribute.Int("job.plots", resp.Plots), attribute.Int("job.output_size", resp.Output.Len()))
 	return
 }
 
+// jobObserve determines the outcome of a job and records its metrics
+func jobObserve(resp *models.JobResponse, err error, errCommand error) {
+	switch {
+	case errors.As(err, new(ErrJobKilled)):
+		resp.Outcome = models.JobOutcomeKilled
+	case errors.As(err, new(ErrDraining)) || errors.As(err, new(ErrVersionForbidden)) || errors.As(err, new(ErrRateLimited)) || errors.As(err, new(ErrQuotaExceeded)):
+		resp.Outcome = models.JobOutcomeRejected
+	case errors.Is(err, context.Canceled) || errors.Is(errCommand, context.Canceled):
+		resp.Outcome = models.JobOutcomeCancelled
+	case err != nil:
+		resp.Outcome = models.JobOutcomeError
+	case errors.Is(errCommand, context.DeadlineExceeded):
+		resp.Outcome = models.JobOutcomeTimeout
+	case errCommand != nil:
+		resp.Outcome = models.JobOutcomeError
+	case resp.IsZIP:
+		resp.Outcome = models.JobOutcomeZIP
+	default:
+		resp.Outcome = models.JobOutcomeOK
+	}
+
+	metricJobs.WithLabelValues(resp.Outcome).Inc()
+	if resp.Version != "" && resp.Duration > 0 {
+		metricJobDuration.WithLabelValues(resp.Version).Observe(resp.Duration.Seconds())
+	}
+	metricJobPlots.Add(float64(resp.Plots))
+	metricJobOutput.Add(float64(resp.Output.Len()))
+}
+
 func jobResponse(resp *models.JobResponse, workspace string, output []byte) (err error) {
 	var file *zip.Writer
 
@@ -75,6 +188,7 @@ func jobResponse(resp *models.JobResponse, workspace string, output []byte) (err
 		if err != nil {
 			return err
 		}
+		resp.Plots++
 
 		_, err = io.Copy(fileWriter, fileReader)
 		return err
@@ -0,0 +1,144 @@
+/*******************************************************************************
+ * Service: job registry
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+type ErrJobNotFound string
+
+func (e ErrJobNotFound) Error() string {
+	return "could not find a running job with ID " + string(e)
+}
+
+type ErrJobKilled string
+
+func (e ErrJobKilled) Error() string {
+	return "job " + string(e) + " was killed"
+}
+
+// jobHandle tracks a job from its admission until its response is created
+type jobHandle struct {
+	info    models.JobInfo
+	cancel  context.CancelCauseFunc
+	killed  bool
+	cpuTime time.Duration
+}
+
+type jobHandleKey struct{}
+
+var (
+	jobRegistry      = make(map[string]*jobHandle)
+	jobRegistryMutex sync.Mutex
+)
+
+// jobRegister adds a job to the registry unless the pool is draining. Its ID is the request ID unless it is missing
+// or already taken. The returned context is cancelled on JobKill.
+func jobRegister(ctx context.Context, data *models.JobRequestQuery) (context.Context, *jobHandle, func(), error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	handle := &jobHandle{
+		info:   models.JobInfo{ID: data.RequestID, Client: data.Client, ClientIP: data.ClientIP, Started: time.Now(), InputSize: len(data.Input)},
+		cancel: cancel,
+	}
+
+	// Checked with the registry locked, so a drain either rejects the job or waits for it
+	jobRegistryMutex.Lock()
+	if Draining() {
+		jobRegistryMutex.Unlock()
+		cancel(nil)
+		return ctx, nil, func() {}, ErrDraining{}
+	}
+	if _, taken := jobRegistry[handle.info.ID]; handle.info.ID == "" || taken {
+		handle.info.ID = RequestIDCreate()
+	}
+	jobRegistry[handle.info.ID] = handle
+	jobRegistryMutex.Unlock()
+
+	return context.WithValue(ctx, jobHandleKey{}, handle), handle, func() {
+		jobRegistryMutex.Lock()
+		delete(jobRegistry, handle.info.ID)
+		jobRegistryMutex.Unlock()
+		cancel(nil)
+	}, nil
+}
+
+// jobUpdate changes the registry's information of the context's job, if any
+func jobUpdate(ctx context.Context, update func(info *models.JobInfo)) {
+	handle, ok := ctx.Value(jobHandleKey{}).(*jobHandle)
+	if !ok {
+		return
+	}
+
+	jobRegistryMutex.Lock()
+	defer jobRegistryMutex.Unlock()
+	update(&handle.info)
+}
+
+// jobAccount adds the CPU time of a process to the context's job, if any
+func jobAccount(ctx context.Context, cpuTime time.Duration) {
+	handle, ok := ctx.Value(jobHandleKey{}).(*jobHandle)
+	if !ok {
+		return
+	}
+
+	jobRegistryMutex.Lock()
+	defer jobRegistryMutex.Unlock()
+	handle.cpuTime += cpuTime
+}
+
+// jobCPUTime returns the CPU time of all processes of the job
+func (h *jobHandle) jobCPUTime() time.Duration {
+	jobRegistryMutex.Lock()
+	defer jobRegistryMutex.Unlock()
+	return h.cpuTime
+}
+
+// jobKilled is true if the job was terminated by JobKill
+func (h *jobHandle) jobKilled() bool {
+	jobRegistryMutex.Lock()
+	defer jobRegistryMutex.Unlock()
+	return h.killed
+}
+
+// JobList returns all running jobs, oldest first
+func JobList() (jobs []models.JobInfo) {
+	jobRegistryMutex.Lock()
+	defer jobRegistryMutex.Unlock()
+
+	jobs = make([]models.JobInfo, 0, len(jobRegistry))
+	for _, handle := range jobRegistry {
+		info := handle.info
+		info.Elapsed = time.Since(info.Started).Seconds()
+		jobs = append(jobs, info)
+	}
+
+	slices.SortFunc(jobs, func(a, b models.JobInfo) int {
+		return cmp.Or(a.Started.Compare(b.Started), cmp.Compare(a.ID, b.ID))
+	})
+	return
+}
+
+// JobKill terminates the process group of the job with the given ID
+func JobKill(id string) error {
+	jobRegistryMutex.Lock()
+	defer jobRegistryMutex.Unlock()
+
+	handle, ok := jobRegistry[id]
+	if !ok {
+		return ErrJobNotFound(id)
+	}
+	handle.killed = true
+	handle.cancel(ErrJobKilled(id))
+	return nil
+}
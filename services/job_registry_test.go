@@ -0,0 +1,117 @@
+/*******************************************************************************
+ * Test: Service: job registry
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"context"
+	"fmt"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJobKill(t *testing.T) {
+	viper.Set("job.user", nil)
+	viper.Set("job.timeout", 10*time.Second)
+	viper.Set("job.concurrency", 0)
+	viper.Set("storage.backend", "local")
+	viper.Set("storage.workspace", t.TempDir())
+	viper.Set("storage.data", t.TempDir())
+	maximaSnapshotList = models.MaximaSnapshotList{{Version: "2023010400", Healthy: true}}
+	jobSlots = nil
+	defer func() {
+		maximaSnapshotList = nil
+		jobSlots = nil
+	}()
+
+	// The child keeps running unless the whole process group is killed
+	pidFile := viper.GetString("storage.data") + "/child.pid"
+	createTestSnapshot(t, "2023010400", fmt.Sprintf(`cat > /dev/null; sleep 30 & echo $! >> %s; wait`, pidFile))
+
+	const jobs = 8
+	var waitGroup sync.WaitGroup
+	results := make([]*models.JobResponse, jobs)
+	errs := make([]error, jobs)
+	for i := 0; i < jobs; i++ {
+		waitGroup.Add(1)
+		go func(i int) {
+			defer waitGroup.Done()
+			results[i], errs[i] = JobCreate(context.Background(), &models.JobRequestQuery{Input: "1+1;", Timeout: 10000, RequestID: "job-" + strconv.Itoa(i%4), Client: "moodle"})
+		}(i)
+	}
+
+	// Duplicate request IDs get a unique job ID
+	var running []models.JobInfo
+	require.Eventually(t, func() bool {
+		running = JobList()
+		for _, info := range running {
+			if info.PID == 0 {
+				return false
+			}
+		}
+		return len(running) == jobs
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ids := map[string]bool{}
+	for _, info := range running {
+		ids[info.ID] = true
+		assert.Equal(t, "moodle", info.Client)
+		assert.Equal(t, "2023010400", info.Version)
+		assert.Equal(t, 4, info.InputSize)
+		assert.DirExists(t, info.Workspace)
+	}
+	assert.Len(t, ids, jobs)
+
+	// Every job has started its child
+	require.Eventually(t, func() bool {
+		pidData, _ := os.ReadFile(pidFile)
+		return len(strings.Fields(string(pidData))) == jobs
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Concurrent readers and killers
+	var killers sync.WaitGroup
+	for _, info := range running {
+		killers.Add(2)
+		go func() {
+			defer killers.Done()
+			_ = JobList()
+		}()
+		go func(id string) {
+			defer killers.Done()
+			assert.NoError(t, JobKill(id))
+		}(info.ID)
+	}
+	killers.Wait()
+	waitGroup.Wait()
+
+	for i := 0; i < jobs; i++ {
+		assert.IsType(t, ErrJobKilled(""), errs[i])
+		assert.Equal(t, models.JobOutcomeKilled, results[i].Outcome)
+	}
+	assert.Empty(t, JobList())
+	assert.Equal(t, ErrJobNotFound("job-0"), JobKill("job-0"))
+
+	// The process groups are gone
+	pidData, err := os.ReadFile(pidFile)
+	require.NoError(t, err)
+	for _, pidText := range strings.Fields(string(pidData)) {
+		pid, err := strconv.Atoi(pidText)
+		require.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+			return err != nil || strings.Contains(string(stat), ") Z ")
+		}, time.Second, 10*time.Millisecond)
+	}
+}
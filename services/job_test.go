@@ -0,0 +1,212 @@
+/*******************************************************************************
+ * Test: Service: job
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"context"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestJobCreate(t *testing.T) {
+	viper.Set("job.user", nil)
+	viper.Set("job.timeout", time.Second)
+	viper.Set("job.concurrency", 1)
+	viper.Set("storage.backend", "local")
+	viper.Set("storage.workspace", t.TempDir())
+	viper.Set("storage.data", t.TempDir())
+	maximaSnapshotList = models.MaximaSnapshotList{{Version: "2023010400", Healthy: true}}
+	jobSlots = nil
+	defer func() {
+		maximaSnapshotList = nil
+		jobSlots = nil
+	}()
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		script      string
+		wantOutput  string
+		wantPlots   int
+		wantOutcome string
+		wantErr     bool
+	}{
+		{"plain output", context.Background(), "cat > /dev/null; echo OUTPUT", "OUTPUT\n", 0, models.JobOutcomeOK, false},
+		{"zip output", context.Background(), "cat > /dev/null; touch plot-1.svg plot-2.svg; echo OUTPUT", "", 2, models.JobOutcomeZIP, false},
+		{"timeout", context.Background(), "exec sleep 5", "", 0, models.JobOutcomeTimeout, false},
+		{"runtime error", context.Background(), "exit 1", "", 0, models.JobOutcomeError, false},
+		{"cancelled request", cancelled, "echo OUTPUT", "", 0, models.JobOutcomeCancelled, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createTestSnapshot(t, "2023010400", tt.script)
+			counter := metricJobs.WithLabelValues(tt.wantOutcome)
+			before := testutil.ToFloat64(counter)
+
+			gotResp, gotErr := JobCreate(tt.ctx, &models.JobRequestQuery{Input: "1+1;", Timeout: 30000})
+			assert.Equal(t, tt.wantErr, gotErr != nil)
+			require.NotNil(t, gotResp)
+			assert.Equal(t, tt.wantOutcome, gotResp.Outcome)
+			assert.Equal(t, tt.wantPlots, gotResp.Plots)
+			if tt.wantOutput != "" {
+				assert.Equal(t, tt.wantOutput, gotResp.Output.String())
+			}
+			assert.Equal(t, before+1, testutil.ToFloat64(counter))
+		})
+	}
+}
+
+func Test_jobQueueAcquire(t *testing.T) {
+	viper.Set("job.concurrency", 1)
+	jobSlots = nil
+	defer func() {
+		jobSlots = nil
+	}()
+
+	release, err := jobQueueAcquire(context.Background(), "", models.JobPriorityNormal)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = jobQueueAcquire(ctx, "", models.JobPriorityNormal)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	release()
+	release, err = jobQueueAcquire(context.Background(), "", models.JobPriorityNormal)
+	assert.NoError(t, err)
+	release()
+}
+
+func TestJobCreate_requestID(t *testing.T) {
+	viper.Set("job.user", nil)
+	viper.Set("job.timeout", time.Second)
+	viper.Set("job.concurrency", 1)
+	viper.Set("job.expose_request_id", true)
+	viper.Set("storage.backend", "local")
+	viper.Set("storage.workspace", t.TempDir())
+	viper.Set("storage.data", t.TempDir())
+	maximaSnapshotList = models.MaximaSnapshotList{{Version: "2023010400", Healthy: true}}
+	jobSlots = nil
+	defer func() {
+		viper.Set("job.expose_request_id", false)
+		maximaSnapshotList = nil
+		jobSlots = nil
+	}()
+
+	createTestSnapshot(t, "2023010400", `cat; echo; basename "$PWD"`)
+
+	gotResp, gotErr := JobCreate(context.Background(), &models.JobRequestQuery{Input: "1+1;", Timeout: 30000, RequestID: "abc-123"})
+	require.NoError(t, gotErr)
+	assert.Contains(t, gotResp.Output.String(), `POOL_REQUEST_ID:"abc-123"$ `)
+	assert.Contains(t, gotResp.Output.String(), "\nmaxima-abc-123-")
+}
+
+func TestJobCreate_versions(t *testing.T) {
+	viper.Set("job.user", nil)
+	viper.Set("job.timeout", time.Second)
+	viper.Set("job.concurrency", 0)
+	viper.Set("storage.backend", "local")
+	viper.Set("storage.workspace", t.TempDir())
+	viper.Set("storage.data", t.TempDir())
+	maximaSnapshotList = models.MaximaSnapshotList{
+		{Version: "2023010400", Healthy: true, Tags: []string{"4.4.2"}},
+		{Version: "2024010100", Healthy: true},
+	}
+	jobSlots = nil
+	defer func() {
+		maximaSnapshotList = nil
+		jobSlots = nil
+	}()
+	createTestSnapshot(t, "2023010400", "cat > /dev/null; echo OUTPUT")
+	createTestSnapshot(t, "2024010100", "cat > /dev/null; echo OUTPUT")
+
+	tests := []struct {
+		name        string
+		version     string
+		versions    []string
+		wantVersion string
+		wantErr     error
+		wantOutcome string
+	}{
+		{"all versions", "2024010100", nil, "2024010100", nil, models.JobOutcomeOK},
+		{"allowed by tag", "4.4.2", []string{"4.4.2"}, "2023010400", nil, models.JobOutcomeOK},
+		{"forbidden version", "2024010100", []string{"4.4.2"}, "", ErrVersionForbidden("2024010100"), models.JobOutcomeRejected},
+		{"allowed default", "", []string{"4.4.2"}, "2023010400", nil, models.JobOutcomeOK},
+		{"allowed fallback of unknown version", "2000010100", []string{"2023010400"}, "2023010400", nil, models.JobOutcomeOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := JobCreate(context.Background(), &models.JobRequestQuery{Input: "1+1;", Timeout: 1000, Version: tt.version, Versions: tt.versions})
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantOutcome, resp.Outcome)
+			assert.Equal(t, tt.wantVersion, resp.Version)
+		})
+	}
+
+	// Forbidden versions are rejected without waiting for a slot
+	viper.Set("job.concurrency", 1)
+	jobSlots = nil
+	release, err := jobQueueAcquire(context.Background(), "other", models.JobPriorityNormal)
+	require.NoError(t, err)
+	defer release()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = JobCreate(ctx, &models.JobRequestQuery{Input: "1+1;", Timeout: 1000, Version: "2024010100", Versions: []string{"4.4.2"}})
+	assert.Equal(t, ErrVersionForbidden("2024010100"), err)
+	assert.NoError(t, ctx.Err())
+}
+
+func TestJobCreate_priority(t *testing.T) {
+	viper.Set("job.user", nil)
+	viper.Set("job.timeout", time.Second)
+	viper.Set("job.concurrency", 1)
+	viper.Set("storage.backend", "local")
+	viper.Set("storage.workspace", t.TempDir())
+	viper.Set("storage.data", t.TempDir())
+	viper.Set("limits.clients", []map[string]any{{"name": "batch", "priority": "low"}, {"name": "interactive", "max_priority": "high"}})
+	maximaSnapshotList = models.MaximaSnapshotList{{Version: "2023010400", Healthy: true}}
+	jobSlots = nil
+	resetClientLimits()
+	defer func() {
+		viper.Set("limits.clients", nil)
+		maximaSnapshotList = nil
+		jobSlots = nil
+		resetClientLimits()
+	}()
+	createTestSnapshot(t, "2023010400", "cat > /dev/null; echo OUTPUT")
+
+	tests := []struct {
+		name         string
+		client       string
+		priority     string
+		wantPriority string
+		wantErr      error
+	}{
+		{"default", "moodle", "", models.JobPriorityNormal, nil},
+		{"default of client", "batch", "", models.JobPriorityLow, nil},
+		{"requested", "interactive", models.JobPriorityHigh, models.JobPriorityHigh, nil},
+		{"requested lower", "moodle", models.JobPriorityLow, models.JobPriorityLow, nil},
+		{"requested above default", "moodle", models.JobPriorityHigh, models.JobPriorityNormal, nil},
+		{"requested above default of client", "batch", models.JobPriorityHigh, models.JobPriorityLow, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := JobCreate(context.Background(), &models.JobRequestQuery{Input: "1+1;", Timeout: 1000, Client: tt.client, Priority: tt.priority})
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantPriority, resp.Priority)
+		})
+	}
+}
@@ -0,0 +1,205 @@
+/*******************************************************************************
+ * Service: maxima snapshot administration
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"errors"
+	"github.com/spf13/viper"
+	"io/fs"
+	"slices"
+	"sync"
+	"time"
+)
+
+type ErrLastSnapshot string
+
+func (e ErrLastSnapshot) Error() string {
+	return "snapshot " + string(e) + " is the last usable one"
+}
+
+type ErrRebuildRunning struct{}
+
+func (e ErrRebuildRunning) Error() string {
+	return "a rebuild of all snapshots is already running"
+}
+
+var (
+	maximaSnapshotRebuild      *models.MaximaSnapshotRebuild
+	maximaSnapshotRebuildMutex sync.Mutex
+)
+
+// MaximaSnapshots returns all snapshots with their usage statistics
+func MaximaSnapshots() (snapshots []models.MaximaSnapshotDetails) {
+	defaultVersion, _ := MaximaSnapshotGet("")
+
+	maximaSnapshotMutex.RLock()
+	defer maximaSnapshotMutex.RUnlock()
+	maximaSnapshotUsageMutex.Lock()
+	defer maximaSnapshotUsageMutex.Unlock()
+	maximaSnapshotUsageLoad()
+
+	snapshots = make([]models.MaximaSnapshotDetails, 0, len(maximaSnapshotList))
+	for _, item := range maximaSnapshotList {
+		snapshots = append(snapshots, models.MaximaSnapshotDetails{MaximaSnapshot: item, Default: item.Version == defaultVersion, Usage: maximaSnapshotUsage[item.Version]})
+	}
+	return
+}
+
+// MaximaSnapshotSetDisabled excludes the snapshot of the given version from serving jobs or includes it again
+func MaximaSnapshotSetDisabled(stackVersion string, disabled bool) error {
+	return maximaSnapshotUpdate(stackVersion, func(snapshot *models.MaximaSnapshot) error {
+		if disabled && !maximaSnapshotUsableWithout(stackVersion) {
+			return ErrLastSnapshot(stackVersion)
+		}
+		snapshot.Disabled = disabled
+		return nil
+	})
+}
+
+// MaximaSnapshotSetDeprecated marks the snapshot of the given version as deprecated for clients; it still serves jobs
+func MaximaSnapshotSetDeprecated(stackVersion string, deprecated bool) error {
+	return maximaSnapshotUpdate(stackVersion, func(snapshot *models.MaximaSnapshot) error {
+		snapshot.Deprecated = deprecated
+		return nil
+	})
+}
+
+// maximaSnapshotUpdate changes the snapshot of the given version and stores the list
+func maximaSnapshotUpdate(stackVersion string, update func(snapshot *models.MaximaSnapshot) error) (err error) {
+	storage, err := Storage()
+	if err != nil {
+		return
+	}
+
+	maximaSnapshotLoad()
+
+	maximaSnapshotMutex.Lock()
+	defer maximaSnapshotMutex.Unlock()
+
+	snapshot := maximaSnapshotList.Get(stackVersion)
+	if snapshot == nil {
+		return ErrSnapshotNotFound(stackVersion)
+	}
+	if err = update(snapshot); err != nil {
+		return
+	}
+	return maximaSnapshotList.Store(storage)
+}
+
+// MaximaSnapshotDelete removes the snapshot of the given version from the storage
+func MaximaSnapshotDelete(stackVersion string) (err error) {
+	storage, err := Storage()
+	if err != nil {
+		return
+	}
+
+	maximaSnapshotLoad()
+
+	maximaSnapshotMutex.Lock()
+	defer maximaSnapshotMutex.Unlock()
+
+	if maximaSnapshotList.Get(stackVersion) == nil {
+		return ErrSnapshotNotFound(stackVersion)
+	}
+	if !maximaSnapshotUsableWithout(stackVersion) {
+		return ErrLastSnapshot(stackVersion)
+	}
+
+	if err = storage.Remove("maxima-" + stackVersion); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	maximaSnapshotList.Remove(stackVersion)
+	if err = maximaSnapshotList.Store(storage); err != nil {
+		return
+	}
+
+	maximaSnapshotUsageMutex.Lock()
+	defer maximaSnapshotUsageMutex.Unlock()
+	maximaSnapshotUsageLoad()
+	delete(maximaSnapshotUsage, stackVersion)
+	return maximaSnapshotUsage.Store(storage)
+}
+
+// maximaSnapshotUsableWithout is true if another snapshot than the given one may serve jobs; the caller must hold
+// maximaSnapshotMutex
+func maximaSnapshotUsableWithout(stackVersion string) bool {
+	force := viper.GetBool("maxima.validation.force")
+	return slices.ContainsFunc(maximaSnapshotList, func(item models.MaximaSnapshot) bool {
+		return item.Version != stackVersion && item.Usable(force)
+	})
+}
+
+// MaximaSnapshotRebuildStart runs MaximaSnapshotCreate in the background; its progress is available by
+// MaximaSnapshotRebuildState and additionally reported to the optional functions
+func MaximaSnapshotRebuildStart(progress func(MaximaSnapshotProgress), finished func(error)) (state models.MaximaSnapshotRebuild, err error) {
+	maximaSnapshotRebuildMutex.Lock()
+	defer maximaSnapshotRebuildMutex.Unlock()
+
+	if maximaSnapshotRebuild != nil && maximaSnapshotRebuild.Running {
+		return maximaSnapshotRebuildCopy(), ErrRebuildRunning{}
+	}
+	maximaSnapshotRebuild = &models.MaximaSnapshotRebuild{Running: true, Started: time.Now(), Results: []models.MaximaSnapshotBuildResult{}}
+
+	go func() {
+		err := MaximaSnapshotCreate(func(item MaximaSnapshotProgress) {
+			maximaSnapshotRebuildProgress(item)
+			if progress != nil {
+				progress(item)
+			}
+		})
+
+		maximaSnapshotRebuildMutex.Lock()
+		now := time.Now()
+		maximaSnapshotRebuild.Running = false
+		maximaSnapshotRebuild.Finished = &now
+		if err != nil {
+			maximaSnapshotRebuild.Error = err.Error()
+		}
+		maximaSnapshotRebuildMutex.Unlock()
+
+		if finished != nil {
+			finished(err)
+		}
+	}()
+
+	return maximaSnapshotRebuildCopy(), nil
+}
+
+func maximaSnapshotRebuildProgress(item MaximaSnapshotProgress) {
+	result := models.MaximaSnapshotBuildResult{Tag: item.Tag, Version: item.Version, Result: models.MaximaSnapshotBuildOK}
+	if item.Err != nil {
+		result.Result, result.Details = models.MaximaSnapshotBuildError, item.Err.Error()
+	} else if item.Validation != nil {
+		result.Result, result.Details = models.MaximaSnapshotBuildUnhealthy, item.Validation.Error()
+	}
+
+	maximaSnapshotRebuildMutex.Lock()
+	defer maximaSnapshotRebuildMutex.Unlock()
+	maximaSnapshotRebuild.Done, maximaSnapshotRebuild.Total = item.Done, item.Total
+	maximaSnapshotRebuild.Results = append(maximaSnapshotRebuild.Results, result)
+}
+
+// MaximaSnapshotRebuildState returns the progress of the current or last rebuild, otherwise nil
+func MaximaSnapshotRebuildState() *models.MaximaSnapshotRebuild {
+	maximaSnapshotRebuildMutex.Lock()
+	defer maximaSnapshotRebuildMutex.Unlock()
+
+	if maximaSnapshotRebuild == nil {
+		return nil
+	}
+	state := maximaSnapshotRebuildCopy()
+	return &state
+}
+
+// maximaSnapshotRebuildCopy returns a snapshot of the rebuild's state; the caller must hold maximaSnapshotRebuildMutex
+func maximaSnapshotRebuildCopy() models.MaximaSnapshotRebuild {
+	state := *maximaSnapshotRebuild
+	state.Results = slices.Clone(state.Results)
+	return state
+}
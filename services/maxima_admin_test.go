@@ -0,0 +1,166 @@
+/*******************************************************************************
+ * Test: Service: maxima snapshot administration
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMaximaSnapshotSetDisabled(t *testing.T) {
+	viper.Set("storage.backend", "local")
+	viper.Set("storage.data", t.TempDir())
+	maximaSnapshotList = models.MaximaSnapshotList{{Version: "2023010400", Healthy: true}, {Version: "2024010100", Healthy: true}}
+	defer func() {
+		maximaSnapshotList = nil
+	}()
+
+	require.NoError(t, MaximaSnapshotSetDisabled("2024010100", true))
+	gotVersion, err := MaximaSnapshotGet("2024010100")
+	require.NoError(t, err)
+	assert.Equal(t, "2023010400", gotVersion)
+
+	assert.Equal(t, ErrLastSnapshot("2023010400"), MaximaSnapshotSetDisabled("2023010400", true))
+	assert.Equal(t, ErrSnapshotNotFound("2000010100"), MaximaSnapshotSetDisabled("2000010100", true))
+
+	var storedList models.MaximaSnapshotList
+	require.NoError(t, storedList.Load(&storageLocal{root: viper.GetString("storage.data")}))
+	assert.True(t, storedList.Get("2024010100").Disabled)
+
+	require.NoError(t, MaximaSnapshotSetDisabled("2024010100", false))
+	gotVersion, err = MaximaSnapshotGet("")
+	require.NoError(t, err)
+	assert.Equal(t, "2024010100", gotVersion)
+}
+
+func TestMaximaSnapshotDelete(t *testing.T) {
+	viper.Set("storage.backend", "local")
+	viper.Set("storage.data", t.TempDir())
+	maximaSnapshotList = models.MaximaSnapshotList{{Version: "2023010400", Healthy: true}, {Version: "2024010100", Healthy: true}}
+	maximaSnapshotUsage = models.MaximaSnapshotUsageMap{"2023010400": {Requests: 3}, "2024010100": {Requests: 5}}
+	defer func() {
+		maximaSnapshotList = nil
+		maximaSnapshotUsage = nil
+	}()
+	for _, item := range maximaSnapshotList {
+		createTestSnapshot(t, item.Version, "exit 0")
+	}
+
+	gotSnapshots := MaximaSnapshots()
+	require.Len(t, gotSnapshots, 2)
+	assert.False(t, gotSnapshots[0].Default)
+	assert.True(t, gotSnapshots[1].Default)
+	assert.Equal(t, int64(5), gotSnapshots[1].Usage.Requests)
+
+	require.NoError(t, MaximaSnapshotDelete("2023010400"))
+	assert.NoFileExists(t, viper.GetString("storage.data")+"/maxima-2023010400")
+	assert.Equal(t, models.MaximaSnapshotList{{Version: "2024010100", Healthy: true}}, maximaSnapshotList)
+	assert.Equal(t, models.MaximaSnapshotUsageMap{"2024010100": {Requests: 5}}, maximaSnapshotUsage)
+
+	assert.Equal(t, ErrLastSnapshot("2024010100"), MaximaSnapshotDelete("2024010100"))
+	assert.Equal(t, ErrSnapshotNotFound("2023010400"), MaximaSnapshotDelete("2023010400"))
+}
+
+func TestMaximaSnapshotRebuildStart(t *testing.T) {
+	viper.Set("job.user", nil)
+	viper.Set("storage.backend", "local")
+	viper.Set("storage.workspace", t.TempDir())
+	viper.Set("storage.data", t.TempDir())
+	viper.Set("job.timeout", 10*time.Second)
+	viper.Set("maxima.workers", 2)
+	viper.Set("maxima.version_constraint", ">= 4.0.0")
+
+	// Fake maxima command which dumps a snapshot into the path of `save-lisp-and-die`
+	command := path.Join(t.TempDir(), "maxima")
+	script := `#!/bin/sh
+printf '#!/bin/sh\n' > "$(printf '%s' "$3" | sed -n 's/.*save-lisp-and-die "\([^"]*\)".*/\1/p')"
+`
+	require.NoError(t, os.WriteFile(command, []byte(script), 0755))
+	viper.Set("maxima.command", command)
+
+	repository := createTestRepository(t, [][2]string{
+		{"v4.7.0", "2023010400"},
+		{"v4.7.1", "2023010400"},
+		{"v4.8.0", "2023060500"},
+	})
+	worktree, err := repository.Worktree()
+	require.NoError(t, err)
+	viper.Set("maxima.repository", worktree.Filesystem.Root())
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	maximaSnapshotList = models.MaximaSnapshotList{{Version: "2000010100", Healthy: true, Created: created}, {Version: "2023060500", Healthy: true, Disabled: true, Tags: []string{"v4.8.0"}}}
+	maximaSnapshotRebuild = nil
+	defer func() {
+		maximaSnapshotList = nil
+		maximaSnapshotRebuild = nil
+	}()
+	createTestSnapshot(t, "2000010100", "exit 0")
+
+	assert.Nil(t, MaximaSnapshotRebuildState())
+
+	var progressCount atomic.Int64
+	state, err := MaximaSnapshotRebuildStart(func(MaximaSnapshotProgress) {
+		progressCount.Add(1)
+	}, nil)
+	require.NoError(t, err)
+	assert.True(t, state.Running)
+
+	require.Eventually(t, func() bool {
+		return !MaximaSnapshotRebuildState().Running
+	}, 10*time.Second, 10*time.Millisecond)
+
+	gotState := MaximaSnapshotRebuildState()
+	assert.Empty(t, gotState.Error)
+	assert.NotNil(t, gotState.Finished)
+	assert.Equal(t, 3, gotState.Total)
+	assert.Len(t, gotState.Results, 3)
+	assert.Equal(t, int64(3), progressCount.Load())
+
+	// Snapshots not built by any tag are kept
+	maximaSnapshotMutex.RLock()
+	require.Len(t, maximaSnapshotList, 3)
+	assert.Equal(t, []string{"2000010100", "2023010400", "2023060500"}, []string{maximaSnapshotList[0].Version, maximaSnapshotList[1].Version, maximaSnapshotList[2].Version})
+	assert.Equal(t, created, maximaSnapshotList.Get("2000010100").Created)
+	assert.False(t, maximaSnapshotList.Get("2023010400").Disabled)
+	assert.Equal(t, []string{"v4.7.0", "v4.7.1"}, maximaSnapshotList.Get("2023010400").Tags)
+	assert.True(t, maximaSnapshotList.Get("2023060500").Disabled)
+	assert.Equal(t, []string{"v4.8.0"}, maximaSnapshotList.Get("2023060500").Tags)
+	want := slices.Clone(maximaSnapshotList)
+	maximaSnapshotMutex.RUnlock()
+	assert.FileExists(t, path.Join(viper.GetString("storage.data"), "maxima-2000010100"))
+	assert.FileExists(t, path.Join(viper.GetString("storage.data"), "maxima-2023060500"))
+
+	// A rebuild of failing tags keeps all snapshots
+	script = "#!/bin/sh\nexit 1\n"
+	require.NoError(t, os.WriteFile(command, []byte(script), 0755))
+	_, err = MaximaSnapshotRebuildStart(nil, nil)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return !MaximaSnapshotRebuildState().Running
+	}, 10*time.Second, 10*time.Millisecond)
+
+	gotState = MaximaSnapshotRebuildState()
+	assert.Empty(t, gotState.Error)
+	for _, result := range gotState.Results {
+		assert.Equal(t, models.MaximaSnapshotBuildError, result.Result)
+	}
+	maximaSnapshotMutex.RLock()
+	defer maximaSnapshotMutex.RUnlock()
+	assert.Equal(t, want, maximaSnapshotList)
+	for _, snapshot := range want {
+		assert.FileExists(t, path.Join(viper.GetString("storage.data"), "maxima-"+snapshot.Version))
+	}
+}
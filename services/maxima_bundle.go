@@ -0,0 +1,283 @@
+/*******************************************************************************
+ * Service: maxima snapshot bundles
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/go-version"
+	"github.com/spf13/viper"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"time"
+)
+
+type ErrInvalidBundle string
+
+func (e ErrInvalidBundle) Error() string {
+	return "invalid snapshot bundle: " + string(e)
+}
+
+var maximaStackVersionRegex = regexp.MustCompile("^[0-9]{10}$")
+
+// MaximaSnapshotExport writes the snapshots of the given versions (or all if none are given) with a manifest of
+// their metadata and checksums as a compressed archive
+func MaximaSnapshotExport(w io.Writer, versions []string) (exported []string, err error) {
+	storage, err := Storage()
+	if err != nil {
+		return
+	}
+
+	maximaSnapshotLoad()
+
+	maximaSnapshotMutex.RLock()
+	defer maximaSnapshotMutex.RUnlock()
+
+	manifest := &models.MaximaSnapshotBundleManifest{Created: time.Now()}
+	for _, item := range maximaSnapshotList {
+		if len(versions) > 0 && !slices.Contains(versions, item.Version) {
+			continue
+		}
+
+		entry := models.MaximaSnapshotBundleEntry{Version: item.Version, Tags: item.Tags, Healthy: item.Healthy, Deprecated: item.Deprecated, Created: item.Created, File: "maxima-" + item.Version}
+		if entry.Size, entry.SHA256, err = maximaSnapshotChecksum(storage, entry.File); err != nil {
+			return
+		}
+		manifest.Snapshots = append(manifest.Snapshots, entry)
+		exported = append(exported, item.Version)
+	}
+
+	for _, v := range versions {
+		if !slices.Contains(exported, v) {
+			return nil, ErrSnapshotNotFound(v)
+		}
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return
+	}
+
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	header := &tar.Header{Name: models.MaximaSnapshotBundleManifestFile, Mode: 0644, Size: int64(len(manifestData)), ModTime: manifest.Created}
+	if err = tarWriter.WriteHeader(header); err != nil {
+		return
+	}
+	if _, err = tarWriter.Write(manifestData); err != nil {
+		return
+	}
+
+	for _, entry := range manifest.Snapshots {
+		if err = maximaSnapshotExportFile(tarWriter, storage, entry); err != nil {
+			return
+		}
+	}
+
+	if err = tarWriter.Close(); err != nil {
+		return
+	}
+	err = gzipWriter.Close()
+	return
+}
+
+func maximaSnapshotExportFile(tarWriter *tar.Writer, storage models.Storage, entry models.MaximaSnapshotBundleEntry) (err error) {
+	file, err := storage.Open(entry.File)
+	if err != nil {
+		return
+	}
+	defer func(file io.ReadCloser) {
+		_ = file.Close()
+	}(file)
+
+	header := &tar.Header{Name: entry.File, Mode: 0755, Size: entry.Size, ModTime: entry.Created}
+	if err = tarWriter.WriteHeader(header); err != nil {
+		return
+	}
+
+	// A file which changed in the meantime does not match its size
+	_, err = io.Copy(tarWriter, file)
+	return
+}
+
+func maximaSnapshotChecksum(storage models.Storage, name string) (size int64, checksum string, err error) {
+	file, err := storage.Open(name)
+	if err != nil {
+		return
+	}
+	defer func(file io.ReadCloser) {
+		_ = file.Close()
+	}(file)
+
+	hash := sha256.New()
+	if size, err = io.Copy(hash, file); err != nil {
+		return
+	}
+	checksum = hex.EncodeToString(hash.Sum(nil))
+	return
+}
+
+// MaximaSnapshotImport verifies a compressed archive of MaximaSnapshotExport and merges its snapshots into the
+// storage. Snapshots of an already existing version are replaced.
+func MaximaSnapshotImport(r io.Reader) (imported []string, err error) {
+	storage, err := Storage()
+	if err != nil {
+		return
+	}
+
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return
+	}
+	tarReader := tar.NewReader(gzipReader)
+
+	// The manifest precedes all snapshots
+	header, err := tarReader.Next()
+	if err != nil {
+		return
+	}
+	if header.Name != models.MaximaSnapshotBundleManifestFile {
+		return nil, ErrInvalidBundle("manifest is missing")
+	}
+	var manifest models.MaximaSnapshotBundleManifest
+	if err = json.NewDecoder(tarReader).Decode(&manifest); err != nil {
+		return
+	}
+
+	entries := make(map[string]models.MaximaSnapshotBundleEntry)
+	for _, entry := range manifest.Snapshots {
+		if !maximaStackVersionRegex.MatchString(entry.Version) || entry.File != "maxima-"+entry.Version {
+			return nil, ErrInvalidBundle(fmt.Sprintf("invalid snapshot %q", entry.Version))
+		}
+		if _, ok := entries[entry.File]; ok {
+			return nil, ErrInvalidBundle(fmt.Sprintf("duplicate snapshot %q", entry.Version))
+		}
+		for _, tag := range entry.Tags {
+			if _, err = version.NewVersion(tag); err != nil {
+				return nil, ErrInvalidBundle(fmt.Sprintf("invalid tag %q of snapshot %q", tag, entry.Version))
+			}
+		}
+		entries[entry.File] = entry
+	}
+
+	// Verify all snapshots in a staging directory before touching the storage
+	staging, err := os.MkdirTemp(viper.GetString("storage.workspace"), "maxima-import-")
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = os.RemoveAll(staging)
+	}()
+
+	verified := make(map[string]bool)
+	for {
+		if header, err = tarReader.Next(); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return
+		}
+
+		entry, ok := entries[header.Name]
+		if !ok || verified[header.Name] || header.Typeflag != tar.TypeReg {
+			return nil, ErrInvalidBundle(fmt.Sprintf("unexpected file %q", header.Name))
+		}
+		if err = maximaSnapshotImportFile(tarReader, path.Join(staging, entry.File), entry); err != nil {
+			return
+		}
+		verified[header.Name] = true
+	}
+	if len(verified) != len(entries) {
+		return nil, ErrInvalidBundle("snapshots are missing")
+	}
+
+	maximaSnapshotLoad()
+
+	maximaSnapshotMutex.Lock()
+	defer maximaSnapshotMutex.Unlock()
+
+	for _, entry := range manifest.Snapshots {
+		if err = maximaSnapshotImportPut(storage, path.Join(staging, entry.File), entry); err != nil {
+			return
+		}
+
+		// Existing snapshots keep their position, new ones are inserted before the first newer snapshot, so the
+		// default version only changes by importing a newer one
+		snapshot := models.MaximaSnapshot{Version: entry.Version, Healthy: entry.Healthy, Deprecated: entry.Deprecated, Created: entry.Created}
+
+		// Tags already claimed by another snapshot stay with it
+		for _, tag := range entry.Tags {
+			claimed := slices.Contains(snapshot.Tags, tag) || slices.ContainsFunc(maximaSnapshotList, func(item models.MaximaSnapshot) bool {
+				return item.Version != entry.Version && slices.Contains(item.Tags, tag)
+			})
+			if !claimed {
+				snapshot.Tags = append(snapshot.Tags, tag)
+			}
+		}
+		slices.SortFunc(snapshot.Tags, maximaTagCompare)
+
+		if previous := maximaSnapshotList.Get(entry.Version); previous != nil {
+			snapshot.Disabled = previous.Disabled
+			*previous = snapshot
+		} else {
+			index := slices.IndexFunc(maximaSnapshotList, func(item models.MaximaSnapshot) bool {
+				return item.Version > entry.Version
+			})
+			if index < 0 {
+				index = len(maximaSnapshotList)
+			}
+			maximaSnapshotList = slices.Insert(maximaSnapshotList, index, snapshot)
+		}
+		imported = append(imported, entry.Version)
+	}
+
+	err = maximaSnapshotList.Store(storage)
+	return
+}
+
+func maximaSnapshotImportPut(storage models.Storage, filePath string, entry models.MaximaSnapshotBundleEntry) (err error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	return storage.Put(entry.File, file, entry.Size, 0755)
+}
+
+func maximaSnapshotImportFile(r io.Reader, filePath string, entry models.MaximaSnapshotBundleEntry) (err error) {
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0755)
+	if err != nil {
+		return
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), r)
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return
+	}
+
+	if size != entry.Size || hex.EncodeToString(hash.Sum(nil)) != entry.SHA256 {
+		return ErrInvalidBundle(fmt.Sprintf("checksum mismatch of snapshot %s", entry.Version))
+	}
+	return
+}
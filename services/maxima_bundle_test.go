@@ -0,0 +1,211 @@
+/*******************************************************************************
+ * Test: Service: maxima snapshot bundles
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// rewriteTestBundle rewrites all files of a bundle by the given function
+func rewriteTestBundle(t *testing.T, bundle []byte, rewrite func(header *tar.Header, data []byte) []byte) []byte {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(bundle))
+	require.NoError(t, err)
+	tarReader := tar.NewReader(gzipReader)
+
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tarReader)
+		require.NoError(t, err)
+
+		if data = rewrite(header, data); data != nil {
+			header.Size = int64(len(data))
+			require.NoError(t, tarWriter.WriteHeader(header))
+			_, err = tarWriter.Write(data)
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+	return buf.Bytes()
+}
+
+func TestMaximaSnapshotImport(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Export from source storage
+	viper.Set("storage.backend", "local")
+	viper.Set("storage.workspace", t.TempDir())
+	viper.Set("storage.data", t.TempDir())
+	maximaSnapshotList = models.MaximaSnapshotList{{Version: "2023010400", Healthy: true, Created: created}, {Version: "2024010100", Healthy: false, Created: created}}
+	defer func() {
+		maximaSnapshotList = nil
+	}()
+	createTestSnapshot(t, "2023010400", "echo 2023010400")
+	createTestSnapshot(t, "2024010100", "echo 2024010100")
+
+	var bundle bytes.Buffer
+	exported, err := MaximaSnapshotExport(&bundle, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2023010400", "2024010100"}, exported)
+
+	_, err = MaximaSnapshotExport(io.Discard, []string{"2000010100"})
+	assert.IsType(t, ErrSnapshotNotFound(""), err)
+
+	withTags := func(tags ...[]string) []byte {
+		return rewriteTestBundle(t, bundle.Bytes(), func(header *tar.Header, data []byte) []byte {
+			if header.Name == models.MaximaSnapshotBundleManifestFile {
+				var manifest models.MaximaSnapshotBundleManifest
+				require.NoError(t, json.Unmarshal(data, &manifest))
+				for i := range manifest.Snapshots {
+					manifest.Snapshots[i].Tags = tags[i]
+				}
+				data, _ = json.Marshal(manifest)
+			}
+			return data
+		})
+	}
+
+	tests := []struct {
+		name         string
+		bundle       []byte
+		existing     models.MaximaSnapshotList
+		wantImported []string
+		wantList     models.MaximaSnapshotList
+		wantErr      bool
+	}{
+		{
+			name:         "valid bundle",
+			bundle:       bundle.Bytes(),
+			existing:     models.MaximaSnapshotList{{Version: "2023060500", Healthy: true}, {Version: "2024010100", Healthy: true}},
+			wantImported: []string{"2023010400", "2024010100"},
+			wantList:     models.MaximaSnapshotList{{Version: "2023010400", Healthy: true, Created: created}, {Version: "2023060500", Healthy: true}, {Version: "2024010100", Healthy: false, Created: created}},
+		},
+		{
+			name:         "keep order of existing snapshots",
+			bundle:       bundle.Bytes(),
+			existing:     models.MaximaSnapshotList{{Version: "2024010100", Healthy: true, Disabled: true}, {Version: "2023060500", Healthy: true}},
+			wantImported: []string{"2023010400", "2024010100"},
+			wantList:     models.MaximaSnapshotList{{Version: "2023010400", Healthy: true, Created: created}, {Version: "2024010100", Healthy: false, Disabled: true, Created: created}, {Version: "2023060500", Healthy: true}},
+		},
+		{
+			name:         "keep claimed tags",
+			bundle:       withTags([]string{"v4.1.0", "v4.2.0"}, []string{"v4.4.0", "v4.2.0", "v4.3.0"}),
+			existing:     models.MaximaSnapshotList{{Version: "2023060500", Tags: []string{"v4.1.0"}, Healthy: true}},
+			wantImported: []string{"2023010400", "2024010100"},
+			wantList:     models.MaximaSnapshotList{{Version: "2023010400", Tags: []string{"v4.2.0"}, Healthy: true, Created: created}, {Version: "2023060500", Tags: []string{"v4.1.0"}, Healthy: true}, {Version: "2024010100", Tags: []string{"v4.3.0", "v4.4.0"}, Healthy: false, Created: created}},
+		},
+		{
+			name:     "invalid tag",
+			bundle:   withTags([]string{"v4.1.0"}, []string{"latest"}),
+			existing: models.MaximaSnapshotList{{Version: "2023060500", Healthy: true}},
+			wantList: models.MaximaSnapshotList{{Version: "2023060500", Healthy: true}},
+			wantErr:  true,
+		},
+		{
+			name: "duplicate snapshot",
+			bundle: rewriteTestBundle(t, bundle.Bytes(), func(header *tar.Header, data []byte) []byte {
+				if header.Name == models.MaximaSnapshotBundleManifestFile {
+					var manifest models.MaximaSnapshotBundleManifest
+					require.NoError(t, json.Unmarshal(data, &manifest))
+					manifest.Snapshots = append(manifest.Snapshots, manifest.Snapshots[0])
+					data, _ = json.Marshal(manifest)
+				}
+				return data
+			}),
+			existing: models.MaximaSnapshotList{{Version: "2023060500", Healthy: true}},
+			wantList: models.MaximaSnapshotList{{Version: "2023060500", Healthy: true}},
+			wantErr:  true,
+		},
+		{
+			name: "corrupted snapshot",
+			bundle: rewriteTestBundle(t, bundle.Bytes(), func(header *tar.Header, data []byte) []byte {
+				if header.Name == "maxima-2024010100" {
+					return append(data, '#')
+				}
+				return data
+			}),
+			existing: models.MaximaSnapshotList{{Version: "2023060500", Healthy: true}},
+			wantList: models.MaximaSnapshotList{{Version: "2023060500", Healthy: true}},
+			wantErr:  true,
+		},
+		{
+			name: "missing snapshot",
+			bundle: rewriteTestBundle(t, bundle.Bytes(), func(header *tar.Header, data []byte) []byte {
+				if header.Name == "maxima-2023010400" {
+					return nil
+				}
+				return data
+			}),
+			existing: models.MaximaSnapshotList{{Version: "2023060500", Healthy: true}},
+			wantList: models.MaximaSnapshotList{{Version: "2023060500", Healthy: true}},
+			wantErr:  true,
+		},
+		{
+			name: "unexpected file",
+			bundle: rewriteTestBundle(t, bundle.Bytes(), func(header *tar.Header, data []byte) []byte {
+				if header.Name == "maxima-2023010400" {
+					header.Name = "../maxima-2023010400"
+				}
+				return data
+			}),
+			existing: models.MaximaSnapshotList{{Version: "2023060500", Healthy: true}},
+			wantList: models.MaximaSnapshotList{{Version: "2023060500", Healthy: true}},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid archive",
+			bundle:   []byte("INVALID"),
+			existing: models.MaximaSnapshotList{{Version: "2023060500", Healthy: true}},
+			wantList: models.MaximaSnapshotList{{Version: "2023060500", Healthy: true}},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("storage.data", t.TempDir())
+			maximaSnapshotList = tt.existing
+
+			gotImported, gotErr := MaximaSnapshotImport(bytes.NewReader(tt.bundle))
+			assert.Equal(t, tt.wantErr, gotErr != nil)
+			assert.Equal(t, tt.wantImported, gotImported)
+			assert.Equal(t, tt.wantList, maximaSnapshotList)
+
+			dir, err := os.ReadDir(viper.GetString("storage.data"))
+			require.NoError(t, err)
+			if tt.wantErr {
+				assert.Empty(t, dir)
+				return
+			}
+
+			for _, version := range tt.wantImported {
+				data, err := os.ReadFile(path.Join(viper.GetString("storage.data"), "maxima-"+version))
+				require.NoError(t, err)
+				assert.Contains(t, string(data), "echo "+version)
+			}
+		})
+	}
+}
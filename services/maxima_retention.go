@@ -0,0 +1,169 @@
+/*******************************************************************************
+ * Service: maxima snapshot retention
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"errors"
+	"github.com/hashicorp/go-version"
+	"github.com/spf13/viper"
+	"io/fs"
+	"slices"
+	"sync"
+	"time"
+)
+
+type MaximaSnapshotRetention struct {
+	KeepLast      int      `mapstructure:"keep_last"`
+	KeepNewerThan string   `mapstructure:"keep_newer_than"`
+	Pinned        []string `mapstructure:"pinned"`
+	UnusedDays    int      `mapstructure:"unused_days"`
+}
+
+var (
+	maximaSnapshotUsage      models.MaximaSnapshotUsageMap
+	maximaSnapshotUsageMutex sync.Mutex
+)
+
+// maximaSnapshotUsageRecord counts a request to the snapshot of the given version
+func maximaSnapshotUsageRecord(stackVersion string) {
+	maximaSnapshotUsageMutex.Lock()
+	defer maximaSnapshotUsageMutex.Unlock()
+
+	maximaSnapshotUsageLoad()
+	usage := maximaSnapshotUsage[stackVersion]
+	usage.Requests++
+	usage.LastUsed = time.Now()
+	maximaSnapshotUsage[stackVersion] = usage
+}
+
+// maximaSnapshotUsageLoad reads the usage statistics from storage unless they are already loaded; the caller must
+// hold maximaSnapshotUsageMutex
+func maximaSnapshotUsageLoad() {
+	if maximaSnapshotUsage == nil {
+		maximaSnapshotUsage = make(models.MaximaSnapshotUsageMap)
+		if storage, err := Storage(); err == nil {
+			_ = maximaSnapshotUsage.Load(storage)
+		}
+	}
+}
+
+// MaximaSnapshotUsageStore persists the usage statistics of all snapshots
+func MaximaSnapshotUsageStore() error {
+	maximaSnapshotUsageMutex.Lock()
+	defer maximaSnapshotUsageMutex.Unlock()
+
+	if maximaSnapshotUsage == nil {
+		return nil
+	}
+	storage, err := Storage()
+	if err != nil {
+		return err
+	}
+	return maximaSnapshotUsage.Store(storage)
+}
+
+// MaximaSnapshotGC removes all snapshots which are not retained by the policy of `maxima.retention`
+func MaximaSnapshotGC() (removed []string, err error) {
+	var retention MaximaSnapshotRetention
+	if err = viper.UnmarshalKey("maxima.retention", &retention); err != nil {
+		return
+	}
+
+	storage, err := Storage()
+	if err != nil {
+		return
+	}
+
+	maximaSnapshotLoad()
+
+	maximaSnapshotMutex.Lock()
+	defer maximaSnapshotMutex.Unlock()
+	maximaSnapshotUsageMutex.Lock()
+	defer maximaSnapshotUsageMutex.Unlock()
+	maximaSnapshotUsageLoad()
+
+	removed, err = retention.Expired(maximaSnapshotList, maximaSnapshotUsage, time.Now())
+	if err != nil || len(removed) == 0 {
+		return
+	}
+
+	// Snapshots which could not be removed stay listed, the others are persisted regardless
+	var errs []error
+	kept := removed[:0]
+	for _, stackVersion := range removed {
+		if err = storage.Remove("maxima-" + stackVersion); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		maximaSnapshotList.Remove(stackVersion)
+		delete(maximaSnapshotUsage, stackVersion)
+		kept = append(kept, stackVersion)
+	}
+	removed = kept
+
+	errs = append(errs, maximaSnapshotList.Store(storage), maximaSnapshotUsage.Store(storage))
+	err = errors.Join(errs...)
+	return
+}
+
+// Expired returns the versions of all snapshots which are not retained by any rule. Without any rule, all snapshots
+// are retained. Snapshots unused for `unused_days` are dropped even if another rule would keep them, unless they are
+// pinned; a snapshot without creation time and requests is of unknown age and not dropped as unused. The newest
+// snapshot is never expired to keep the pool operational.
+func (r *MaximaSnapshotRetention) Expired(list models.MaximaSnapshotList, usage models.MaximaSnapshotUsageMap, now time.Time) (expired []string, err error) {
+	if r.KeepLast <= 0 && r.KeepNewerThan == "" && r.UnusedDays <= 0 {
+		return
+	}
+
+	var keepNewerThan *version.Version
+	if r.KeepNewerThan != "" {
+		if keepNewerThan, err = version.NewVersion(r.KeepNewerThan); err != nil {
+			return
+		}
+	}
+
+	// Sort snapshots from newest to oldest
+	type snapshot struct {
+		models.MaximaSnapshot
+		version *version.Version
+	}
+	var snapshots []snapshot
+	for _, item := range list {
+		itemVersion, err := version.NewVersion(item.Version)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot{item, itemVersion})
+	}
+	slices.SortFunc(snapshots, func(a, b snapshot) int {
+		return b.version.Compare(a.version)
+	})
+
+	for i, item := range snapshots {
+		lastActivity := item.Created
+		if lastUsed := usage[item.Version].LastUsed; lastUsed.After(lastActivity) {
+			lastActivity = lastUsed
+		}
+
+		unused := r.UnusedDays > 0 && !lastActivity.IsZero() && now.Sub(lastActivity) >= time.Duration(r.UnusedDays)*24*time.Hour
+
+		switch {
+		case i == 0:
+		case slices.Contains(r.Pinned, item.Version):
+		case unused:
+			expired = append(expired, item.Version)
+		case r.KeepLast <= 0 && keepNewerThan == nil:
+		case i < r.KeepLast:
+		case keepNewerThan != nil && item.version.GreaterThan(keepNewerThan):
+		default:
+			expired = append(expired, item.Version)
+		}
+	}
+	return
+}
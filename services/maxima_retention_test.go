@@ -0,0 +1,116 @@
+/*******************************************************************************
+ * Test: Service: maxima snapshot retention
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMaximaSnapshotRetention_Expired(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	list := models.MaximaSnapshotList{
+		{Version: "2023010400", Created: now.AddDate(0, -6, 0)},
+		{Version: "2024010100", Created: now.AddDate(0, -3, 0)},
+		{Version: "2023060500", Created: now.AddDate(0, -6, 0)},
+		{Version: "2024030100", Created: now.AddDate(0, 0, -1)},
+		{Version: "2022010100"},
+	}
+	usage := models.MaximaSnapshotUsageMap{
+		"2023010400": {Requests: 10, LastUsed: now.AddDate(0, 0, -2)},
+		"2023060500": {Requests: 10, LastUsed: now.AddDate(0, -1, 0)},
+	}
+
+	tests := []struct {
+		name        string
+		retention   MaximaSnapshotRetention
+		wantExpired []string
+		wantErr     bool
+	}{
+		{"no rules", MaximaSnapshotRetention{}, nil, false},
+		{"keep last", MaximaSnapshotRetention{KeepLast: 2}, []string{"2023060500", "2023010400", "2022010100"}, false},
+		{"keep newer than", MaximaSnapshotRetention{KeepNewerThan: "2023060500"}, []string{"2023060500", "2023010400", "2022010100"}, false},
+		{"keep pinned", MaximaSnapshotRetention{KeepLast: 1, Pinned: []string{"2023010400"}}, []string{"2024010100", "2023060500", "2022010100"}, false},
+		{"drop unused", MaximaSnapshotRetention{UnusedDays: 7}, []string{"2024010100", "2023060500"}, false},
+		{"drop unused within keep last", MaximaSnapshotRetention{KeepLast: 4, UnusedDays: 7}, []string{"2024010100", "2023060500", "2022010100"}, false},
+		{"drop unused within keep newer than", MaximaSnapshotRetention{KeepNewerThan: "2022010100", UnusedDays: 7}, []string{"2024010100", "2023060500", "2022010100"}, false},
+		{"keep pinned unused", MaximaSnapshotRetention{UnusedDays: 7, Pinned: []string{"2024010100"}}, []string{"2023060500"}, false},
+		{"keep newest", MaximaSnapshotRetention{KeepNewerThan: "2025010100"}, []string{"2024010100", "2023060500", "2023010400", "2022010100"}, false},
+		{"invalid version", MaximaSnapshotRetention{KeepNewerThan: "invalid"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotExpired, gotErr := tt.retention.Expired(list, usage, now)
+			assert.Equal(t, tt.wantErr, gotErr != nil)
+			assert.Equal(t, tt.wantExpired, gotExpired)
+		})
+	}
+}
+
+func TestMaximaSnapshotGC(t *testing.T) {
+	viper.Set("storage.data", t.TempDir())
+	viper.Set("maxima.retention", map[string]any{"keep_last": 1, "pinned": []string{"2023010400"}})
+	defer viper.Set("maxima.retention", nil)
+
+	maximaSnapshotList = models.MaximaSnapshotList{{Version: "2023010400"}, {Version: "2023060500"}, {Version: "2024010100"}}
+	maximaSnapshotUsage = models.MaximaSnapshotUsageMap{"2023060500": {Requests: 1}}
+	defer func() {
+		maximaSnapshotList = nil
+		maximaSnapshotUsage = nil
+	}()
+	for _, item := range maximaSnapshotList {
+		createTestSnapshot(t, item.Version, "exit 0")
+	}
+
+	gotRemoved, err := MaximaSnapshotGC()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2023060500"}, gotRemoved)
+	assert.Equal(t, models.MaximaSnapshotList{{Version: "2023010400"}, {Version: "2024010100"}}, maximaSnapshotList)
+	assert.Equal(t, models.MaximaSnapshotUsageMap{}, maximaSnapshotUsage)
+	assert.NoFileExists(t, viper.GetString("storage.data")+"/maxima-2023060500")
+
+	var storedList models.MaximaSnapshotList
+	require.NoError(t, storedList.Load(&storageLocal{root: viper.GetString("storage.data")}))
+	assert.Equal(t, maximaSnapshotList, storedList)
+}
+
+func TestMaximaSnapshotGC_removeFailed(t *testing.T) {
+	viper.Set("storage.data", t.TempDir())
+	viper.Set("maxima.retention", map[string]any{"keep_last": 1})
+	defer viper.Set("maxima.retention", nil)
+
+	maximaSnapshotList = models.MaximaSnapshotList{{Version: "2023010400"}, {Version: "2023060500"}, {Version: "2024010100"}}
+	maximaSnapshotUsage = models.MaximaSnapshotUsageMap{"2023010400": {Requests: 1}, "2023060500": {Requests: 2}}
+	defer func() {
+		maximaSnapshotList = nil
+		maximaSnapshotUsage = nil
+	}()
+	createTestSnapshot(t, "2023060500", "exit 0")
+	createTestSnapshot(t, "2024010100", "exit 0")
+	// A non-empty directory in place of the snapshot can't be removed
+	require.NoError(t, os.MkdirAll(viper.GetString("storage.data")+"/maxima-2023010400/bin", 0755))
+
+	gotRemoved, err := MaximaSnapshotGC()
+	assert.Error(t, err)
+	assert.Equal(t, []string{"2023060500"}, gotRemoved)
+	assert.Equal(t, models.MaximaSnapshotList{{Version: "2023010400"}, {Version: "2024010100"}}, maximaSnapshotList)
+	assert.Equal(t, models.MaximaSnapshotUsageMap{"2023010400": {Requests: 1}}, maximaSnapshotUsage)
+
+	storage := &storageLocal{root: viper.GetString("storage.data")}
+	var storedList models.MaximaSnapshotList
+	require.NoError(t, storedList.Load(storage))
+	assert.Equal(t, maximaSnapshotList, storedList)
+	storedUsage := make(models.MaximaSnapshotUsageMap)
+	require.NoError(t, storedUsage.Load(storage))
+	assert.Equal(t, maximaSnapshotUsage, storedUsage)
+}
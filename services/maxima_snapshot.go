@@ -8,11 +8,19 @@
 package services
 
 import (
+	"context"
 	_ "embed"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"Moodle_Maxima_Pool/models"
 	"github.com/go-git/go-git/v5"
@@ -27,6 +35,18 @@ func (e ErrNoSnapshotsFound) Error() string {
 	return "no snapshots are found in storage path"
 }
 
+type ErrDuplicateVersion string
+
+func (e ErrDuplicateVersion) Error() string {
+	return "snapshot is already built by another tag for version " + string(e)
+}
+
+type ErrSnapshotNotFound string
+
+func (e ErrSnapshotNotFound) Error() string {
+	return "could not find a snapshot of version " + string(e)
+}
+
 type ErrVersionNotFound string
 
 func (e ErrVersionNotFound) Error() string {
@@ -37,21 +57,36 @@ var (
 	//go:embed maximalocal.mac
 	maximaLocal []byte
 
-	maximaVersionRegex = regexp.MustCompile("stackmaximaversion:([0-9]{10})\\$")
-	maximaSnapshotList models.MaximaSnapshotList
+	maximaVersionRegex  = regexp.MustCompile("stackmaximaversion:([0-9]{10})\\$")
+	maximaSnapshotList  models.MaximaSnapshotList
+	maximaSnapshotMutex sync.RWMutex
 )
 
-func MaximaSnapshotCreate() (err error) {
-	// Remove old versions
-	dir, err := os.ReadDir(viper.GetString("storage.data"))
+type MaximaSnapshotProgress struct {
+	Tag        string
+	Version    string
+	Done       int
+	Total      int
+	Err        error
+	Validation error
+}
+
+type maximaSnapshotBuild struct {
+	tag        *object.Tag
+	version    string
+	err        error
+	validation error
+}
+
+// MaximaSnapshotCreate builds a snapshot for every tag matching the version constraint. Tags are
+// exported and dumped by up to `maxima.workers` workers; progress is reported as tags finish.
+// A failing tag is skipped without affecting the others and its former snapshot is kept.
+// Snapshots failing the optional validation stage are kept, but marked as unhealthy.
+func MaximaSnapshotCreate(progress func(MaximaSnapshotProgress)) (err error) {
+	storage, err := Storage()
 	if err != nil {
 		return
 	}
-	for _, item := range dir {
-		if err = os.RemoveAll(path.Join(viper.GetString("storage.data"), item.Name())); err != nil {
-			return
-		}
-	}
 
 	// Workspace for repository
 	workspace, err := os.MkdirTemp(viper.GetString("storage.workspace"), "maxima-")
@@ -69,38 +104,227 @@ func MaximaSnapshotCreate() (err error) {
 	}
 
 	// Clone git repository
-	repository, err := git.PlainClone(workspace, false, &git.CloneOptions{URL: viper.GetString("maxima.repository")})
+	repository, err := git.PlainClone(path.Join(workspace, "repository"), true, &git.CloneOptions{URL: viper.GetString("maxima.repository")})
 	if err != nil {
 		return
 	}
 
-	// Get repository's worktree
-	worktree, err := repository.Worktree()
+	// Get all tags from repository and filter them
+	tags, err := repository.TagObjects()
+	if err != nil {
+		return
+	}
+	var builds []*maximaSnapshotBuild
+	err = tags.ForEach(func(item *object.Tag) error {
+		if tag, err := version.NewVersion(item.Name); err == nil && versionConstraint.Check(tag) {
+			builds = append(builds, &maximaSnapshotBuild{tag: item})
+		}
+		return nil
+	})
 	if err != nil {
 		return
 	}
 
-	// Get all tags from repository and process them
-	tags, err := repository.TagObjects()
+	// Snapshots are replaced in place, so running jobs keep being served during the build
+	maximaSnapshotBuildAll(workspace, builds, storage, progress)
+
+	maximaSnapshotLoad()
+
+	maximaSnapshotMutex.Lock()
+	defer maximaSnapshotMutex.Unlock()
+
+	// Successful builds replace their entries in place or are inserted before the first newer snapshot. Entries of
+	// failed builds and snapshots not built by any tag, e.g. imported ones, are kept; removal is left to the
+	// retention policy.
+	rebuilt := make(map[string]bool)
+	for _, build := range builds {
+		if build.err != nil {
+			continue
+		}
+		rebuilt[build.version] = true
+		snapshot := models.MaximaSnapshot{Version: build.version, Healthy: build.validation == nil, Created: time.Now()}
+		if previous := maximaSnapshotList.Get(build.version); previous != nil {
+			snapshot.Disabled, snapshot.Deprecated = previous.Disabled, previous.Deprecated
+			*previous = snapshot
+			continue
+		}
+		index := slices.IndexFunc(maximaSnapshotList, func(item models.MaximaSnapshot) bool {
+			return item.Version > build.version
+		})
+		if index < 0 {
+			index = len(maximaSnapshotList)
+		}
+		maximaSnapshotList = slices.Insert(maximaSnapshotList, index, snapshot)
+	}
+
+	// Tags of the same version are aliases of its snapshot, a tag moves from its former version
+	for _, build := range builds {
+		if !rebuilt[build.version] || (build.err != nil && !errors.As(build.err, new(ErrDuplicateVersion))) {
+			continue
+		}
+		for i := range maximaSnapshotList {
+			maximaSnapshotList[i].Tags = slices.DeleteFunc(maximaSnapshotList[i].Tags, func(tag string) bool {
+				return tag == build.tag.Name
+			})
+		}
+		snapshot := maximaSnapshotList.Get(build.version)
+		snapshot.Tags = append(snapshot.Tags, build.tag.Name)
+	}
+	for i := range maximaSnapshotList {
+		if rebuilt[maximaSnapshotList[i].Version] {
+			slices.SortFunc(maximaSnapshotList[i].Tags, maximaTagCompare)
+		}
+	}
+
+	return maximaSnapshotList.Store(storage)
+}
+
+// maximaTagCompare orders tags by their version; tags which are no valid version are ordered as strings after all others
+func maximaTagCompare(a, b string) int {
+	versionA, errA := version.NewVersion(a)
+	versionB, errB := version.NewVersion(b)
+	switch {
+	case errA == nil && errB == nil:
+		return versionA.Compare(versionB)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// maximaSnapshotBuildAll builds the tags with up to `maxima.workers` workers. Tags of the same stack version are
+// resolved like a sequential build: the last tag in order is built and earlier ones only if it fails, the others are
+// marked as duplicates. Progress is reported once the outcome of a tag is known.
+func maximaSnapshotBuildAll(workspace string, builds []*maximaSnapshotBuild, storage models.Storage, progress func(MaximaSnapshotProgress)) {
+	var (
+		progressMutex sync.Mutex
+		waitGroup     sync.WaitGroup
+		done          int
+		queue         = make(chan []int)
+	)
+
+	report := func(build *maximaSnapshotBuild) {
+		switch {
+		case errors.As(build.err, new(ErrDuplicateVersion)):
+			metricSnapshotBuilds.WithLabelValues("duplicate").Inc()
+		case build.err != nil:
+			metricSnapshotBuilds.WithLabelValues("error").Inc()
+		case build.validation != nil:
+			metricSnapshotBuilds.WithLabelValues("unhealthy").Inc()
+		default:
+			metricSnapshotBuilds.WithLabelValues("ok").Inc()
+		}
+
+		progressMutex.Lock()
+		defer progressMutex.Unlock()
+		done++
+		if progress != nil {
+			progress(MaximaSnapshotProgress{Tag: build.tag.Name, Version: build.version, Done: done, Total: len(builds), Err: build.err, Validation: build.validation})
+		}
+	}
+	tagWorkspace := func(index int) string {
+		return path.Join(workspace, "tags", strconv.Itoa(index))
+	}
+
+	// Tags are exported one after another, go-git's object storage is not safe for concurrent use
+	var versions []string
+	groups := make(map[string][]int)
+	for index, build := range builds {
+		build.err = maximaSnapshotExport(build.tag, tagWorkspace(index))
+		if build.err == nil {
+			build.version, build.err = getStackVersion(tagWorkspace(index))
+		}
+		if build.err != nil {
+			_ = os.RemoveAll(tagWorkspace(index))
+			report(build)
+			continue
+		}
+		if groups[build.version] == nil {
+			versions = append(versions, build.version)
+		}
+		groups[build.version] = append(groups[build.version], index)
+	}
+
+	workers := viper.GetInt("maxima.workers")
+	if workers < 1 {
+		workers = 1
+	}
+
+	for i := 0; i < workers; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for group := range queue {
+				built := false
+				for i := len(group) - 1; i >= 0; i-- {
+					build := builds[group[i]]
+					if built {
+						build.err = ErrDuplicateVersion(build.version)
+					} else {
+						build.err = maximaSnapshotCreate(tagWorkspace(group[i]), build.version, storage)
+						if build.err == nil && viper.GetBool("maxima.validation.enabled") {
+							build.validation = maximaSnapshotValidate(build.version)
+						}
+						built = build.err == nil
+					}
+					_ = os.RemoveAll(tagWorkspace(group[i]))
+					report(build)
+				}
+			}
+		}()
+	}
+
+	for _, version := range versions {
+		queue <- groups[version]
+	}
+	close(queue)
+	waitGroup.Wait()
+}
+
+// maximaSnapshotExport writes the `stack/maxima` tree of a tag into the given directory
+func maximaSnapshotExport(tag *object.Tag, workspace string) (err error) {
+	commit, err := tag.Commit()
+	if err != nil {
+		return
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return
+	}
+
+	subtree, err := tree.Tree(path.Join("stack", "maxima"))
 	if err != nil {
 		return
 	}
-	err = tags.ForEach(func(item *object.Tag) (err error) {
-		tag, err2 := version.NewVersion(item.Name)
-		if err2 != nil || !versionConstraint.Check(tag) {
-			return
+
+	return subtree.Files().ForEach(func(file *object.File) error {
+		filePath := path.Join(workspace, "stack", "maxima", file.Name)
+		if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+			return err
 		}
 
-		// Reset repository to tag
-		if err = worktree.Reset(&git.ResetOptions{Commit: item.Target, Mode: git.HardReset}); err != nil {
-			return
+		fileReader, err := file.Reader()
+		if err != nil {
+			return err
 		}
+		defer func(fileReader io.ReadCloser) {
+			_ = fileReader.Close()
+		}(fileReader)
 
-		return maximaSnapshotCreate(workspace, item)
-	})
+		fileWriter, err := os.Create(filePath)
+		if err != nil {
+			return err
+		}
 
-	err = maximaSnapshotList.Store()
-	return
+		if _, err = io.Copy(fileWriter, fileReader); err != nil {
+			_ = fileWriter.Close()
+			return err
+		}
+		return fileWriter.Close()
+	})
 }
 
 func getStackVersion(workspace string) (string, error) {
@@ -117,12 +341,8 @@ func getStackVersion(workspace string) (string, error) {
 	return string(match[1]), nil
 }
 
-func maximaSnapshotCreate(workspace string, tag *object.Tag) (err error) {
-	stackVersion, err := getStackVersion(workspace)
-	if err != nil {
-		return err
-	}
-
+// maximaSnapshotCreate dumps the snapshot into the job's workspace and puts it into the storage afterwards
+func maximaSnapshotCreate(workspace string, stackVersion string, storage models.Storage) (err error) {
 	batchString := fmt.Sprintf(
 		`file_search_maxima:append([sconcat("%s")],file_search_maxima)$`+
 			`file_search_lisp:append([sconcat("%s")],file_search_lisp)$`+
@@ -132,33 +352,87 @@ func maximaSnapshotCreate(workspace string, tag *object.Tag) (err error) {
 		path.Join(workspace, "stack", "maxima", "###.{mac,mc}"),
 		path.Join(workspace, "stack", "maxima", "###.{lisp}"),
 		maximaLocal,
-		path.Join(viper.GetString("storage.data"), "maxima-"+stackVersion))
+		"maxima-"+stackVersion)
 
-	_, _, _, clean, err := CommandCreate(viper.GetDuration("job.timeout"), "", viper.GetString("maxima.command"), "--quiet", "--batch-string", batchString)
+	_, _, jobWorkspace, clean, err := CommandCreate(context.Background(), viper.GetDuration("job.timeout"), "", viper.GetString("maxima.command"), "--quiet", "--batch-string", batchString)
 	defer clean()
 	if err != nil {
 		return
 	}
-	maximaSnapshotList = append(maximaSnapshotList, models.MaximaSnapshot(stackVersion))
-	return
-}
 
-func MaximaSnapshotGet(v string) (version string, err error) {
-	if maximaSnapshotList == nil {
-		_ = maximaSnapshotList.Load()
+	file, err := os.Open(path.Join(jobWorkspace, "maxima-"+stackVersion))
+	if err != nil {
+		return
 	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
 
-	if len(maximaSnapshotList) == 0 {
-		return "", &ErrNoSnapshotsFound{}
+	info, err := file.Stat()
+	if err != nil {
+		return
 	}
+	return storage.Put("maxima-"+stackVersion, file, info.Size(), 0755)
+}
 
-	version = string((maximaSnapshotList)[len(maximaSnapshotList)-1])
+func MaximaSnapshotGet(v string) (version string, err error) {
+	return maximaSnapshotGetAllowed(v, nil)
+}
 
+// maximaSnapshotGetAllowed resolves a version or tag like MaximaSnapshotGet, but falls back to the newest usable
+// snapshot a client with the given allowed versions may use. Without such a snapshot the default version is returned.
+func maximaSnapshotGetAllowed(v string, versions []string) (version string, err error) {
+	maximaSnapshotLoad()
+
+	maximaSnapshotMutex.RLock()
+	defer maximaSnapshotMutex.RUnlock()
+
+	force := viper.GetBool("maxima.validation.force")
+	client := models.Client{Versions: versions}
+	var defaultVersion string
 	for _, item := range maximaSnapshotList {
-		if string(item) == v {
-			return v, nil
+		if !item.Usable(force) {
+			continue
+		}
+		if item.Version == v || slices.Contains(item.Tags, v) {
+			return item.Version, nil
 		}
+		if client.AllowsVersion(item.Version, item.Tags) {
+			version = item.Version
+		}
+		defaultVersion = item.Version
 	}
 
+	if defaultVersion == "" {
+		return "", &ErrNoSnapshotsFound{}
+	}
+	if version == "" {
+		version = defaultVersion
+	}
 	return
 }
+
+// maximaSnapshotLoad reads the snapshot list from storage unless it is already loaded
+func maximaSnapshotLoad() {
+	maximaSnapshotMutex.RLock()
+	loaded := maximaSnapshotList != nil
+	maximaSnapshotMutex.RUnlock()
+	if loaded {
+		return
+	}
+
+	maximaSnapshotMutex.Lock()
+	defer maximaSnapshotMutex.Unlock()
+	if storage, err := Storage(); maximaSnapshotList == nil && err == nil {
+		_ = maximaSnapshotList.Load(storage)
+	}
+}
+
+// MaximaSnapshotPath returns the local path of the snapshot's executable
+func MaximaSnapshotPath(stackVersion string) (string, error) {
+	storage, err := Storage()
+	if err != nil {
+		return "", err
+	}
+	return storage.Local("maxima-" + stackVersion)
+}
@@ -0,0 +1,182 @@
+/*******************************************************************************
+ * Test: Service: maxima snapshots
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// createTestRepository creates a repository with one annotated tag per entry of tags (tag name => stack version)
+func createTestRepository(t *testing.T, tags [][2]string) *git.Repository {
+	dir := t.TempDir()
+	repository, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+	worktree, err := repository.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(path.Join(dir, "stack", "maxima"), 0755))
+
+	signature := &object.Signature{Name: "test", Email: "test@example.org", When: time.Now()}
+	for _, tag := range tags {
+		err = os.WriteFile(path.Join(dir, "stack", "maxima", "stackmaxima.mac"), []byte("stackmaximaversion:"+tag[1]+"$\n"), 0644)
+		require.NoError(t, err)
+		_, err = worktree.Add("stack")
+		require.NoError(t, err)
+		hash, err := worktree.Commit(tag[0], &git.CommitOptions{Author: signature, AllowEmptyCommits: true})
+		require.NoError(t, err)
+		_, err = repository.CreateTag(tag[0], hash, &git.CreateTagOptions{Tagger: signature, Message: tag[0]})
+		require.NoError(t, err)
+	}
+
+	return repository
+}
+
+func Test_maximaSnapshotBuildAll(t *testing.T) {
+	viper.Set("job.user", nil)
+	viper.Set("storage.workspace", t.TempDir())
+	viper.Set("storage.data", t.TempDir())
+	viper.Set("job.timeout", 10*time.Second)
+
+	// Fake maxima command which dumps a snapshot into the path of `save-lisp-and-die`
+	command := path.Join(t.TempDir(), "maxima")
+	failFile := path.Join(t.TempDir(), "fail")
+	script := `#!/bin/sh
+if [ -s ` + failFile + ` ] && printf '%s' "$3" | grep -qF "$(cat ` + failFile + `)"; then exit 1; fi
+printf '#!/bin/sh\n' > "$(printf '%s' "$3" | sed -n 's/.*save-lisp-and-die "\([^"]*\)".*/\1/p')"
+`
+	err := os.WriteFile(command, []byte(script), 0755)
+	require.NoError(t, err)
+	viper.Set("maxima.command", command)
+
+	repository := createTestRepository(t, [][2]string{
+		{"v4.7.0", "2023010400"},
+		{"v4.7.1", "2023010400"},
+		{"v4.8.0", "2023060500"},
+		{"v4.9.0", "2024010100"},
+	})
+
+	tests := []struct {
+		name     string
+		workers  int
+		failLast bool
+	}{
+		{"sequential", 1, false},
+		{"parallel", 3, false},
+		{"parallel with failing duplicate", 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("maxima.workers", tt.workers)
+
+			var builds []*maximaSnapshotBuild
+			tags, err := repository.TagObjects()
+			require.NoError(t, err)
+			require.NoError(t, tags.ForEach(func(tag *object.Tag) error {
+				builds = append(builds, &maximaSnapshotBuild{tag: tag})
+				return nil
+			}))
+
+			// The last tag of a duplicate version wins unless its build fails
+			var duplicates []int
+			for index, build := range builds {
+				if build.tag.Name == "v4.7.0" || build.tag.Name == "v4.7.1" {
+					duplicates = append(duplicates, index)
+				}
+			}
+			winner, failing := builds[duplicates[1]].tag.Name, ""
+			if tt.failLast {
+				winner, failing = builds[duplicates[0]].tag.Name, "/tags/"+strconv.Itoa(duplicates[1])+"/"
+			}
+			require.NoError(t, os.WriteFile(failFile, []byte(failing), 0644))
+
+			var progressList []MaximaSnapshotProgress
+			storage := &storageLocal{root: viper.GetString("storage.data")}
+			maximaSnapshotBuildAll(t.TempDir(), builds, storage, func(progress MaximaSnapshotProgress) {
+				progressList = append(progressList, progress)
+			})
+
+			assert.Len(t, progressList, len(builds))
+			for _, item := range progressList {
+				for _, build := range builds {
+					if build.tag.Name == item.Tag {
+						assert.Equal(t, build.err, item.Err, "progress of %s", item.Tag)
+					}
+				}
+			}
+			assert.Equal(t, len(builds), progressList[len(progressList)-1].Done)
+
+			built := map[string]int{}
+			for index, build := range builds {
+				switch {
+				case build.err == nil:
+					built[build.version]++
+					if build.version == "2023010400" {
+						assert.Equal(t, winner, build.tag.Name)
+					}
+				case tt.failLast && index == duplicates[1]:
+					assert.NotEqual(t, ErrDuplicateVersion(build.version), build.err)
+				default:
+					assert.IsType(t, ErrDuplicateVersion(""), build.err)
+				}
+			}
+			assert.Equal(t, map[string]int{"2023010400": 1, "2023060500": 1, "2024010100": 1}, built)
+			for version := range built {
+				assert.FileExists(t, path.Join(viper.GetString("storage.data"), "maxima-"+version))
+			}
+		})
+	}
+}
+
+func TestMaximaSnapshotGet(t *testing.T) {
+	maximaSnapshotList = models.MaximaSnapshotList{
+		{Version: "2023010400", Healthy: true},
+		{Version: "2023060500", Healthy: true},
+		{Version: "2024010100", Healthy: false},
+	}
+	defer func() {
+		maximaSnapshotList = nil
+	}()
+
+	tests := []struct {
+		name        string
+		version     string
+		force       bool
+		wantVersion string
+	}{
+		{"existing version", "2023010400", false, "2023010400"},
+		{"default version", "", false, "2023060500"},
+		{"unknown version", "2000010100", false, "2023060500"},
+		{"unhealthy version", "2024010100", false, "2023060500"},
+		{"forced unhealthy version", "2024010100", true, "2024010100"},
+		{"forced default version", "", true, "2024010100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("maxima.validation.force", tt.force)
+			gotVersion, err := MaximaSnapshotGet(tt.version)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantVersion, gotVersion)
+		})
+	}
+}
+
+func Test_maximaTagCompare(t *testing.T) {
+	tags := []string{"v4.10.0", "latest", "v4.2.0", "beta", "v4.9.1"}
+	slices.SortFunc(tags, maximaTagCompare)
+	assert.Equal(t, []string{"v4.2.0", "v4.9.1", "v4.10.0", "beta", "latest"}, tags)
+}
@@ -0,0 +1,75 @@
+/*******************************************************************************
+ * Service: maxima snapshot validation
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/viper"
+	"regexp"
+)
+
+type MaximaSnapshotTest struct {
+	Input    string `mapstructure:"input"`
+	Expected string `mapstructure:"expected"`
+}
+
+type ErrSnapshotValidation struct {
+	Input  string
+	Output string
+	Err    error
+}
+
+func (e *ErrSnapshotValidation) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("validation of %q failed: %s", e.Input, e.Err)
+	}
+	return fmt.Sprintf("validation of %q failed with unexpected output %q", e.Input, e.Output)
+}
+
+func (e *ErrSnapshotValidation) Unwrap() error {
+	return e.Err
+}
+
+// maximaSnapshotValidate runs the configured test suite against the snapshot of the given version
+func maximaSnapshotValidate(stackVersion string) (err error) {
+	var tests []MaximaSnapshotTest
+	if err = viper.UnmarshalKey("maxima.validation.tests", &tests); err != nil {
+		return
+	}
+
+	for _, test := range tests {
+		if err = maximaSnapshotRunTest(stackVersion, test); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func maximaSnapshotRunTest(stackVersion string, test MaximaSnapshotTest) (err error) {
+	expected, err := regexp.Compile(test.Expected)
+	if err != nil {
+		return
+	}
+
+	command, err := MaximaSnapshotPath(stackVersion)
+	if err != nil {
+		return
+	}
+
+	stdOut, _, _, clean, err := CommandCreate(context.Background(), viper.GetDuration("job.timeout"), test.Input, command, "--quiet")
+	defer clean()
+	if err != nil {
+		return &ErrSnapshotValidation{Input: test.Input, Output: string(stdOut), Err: err}
+	}
+
+	if !expected.Match(stdOut) {
+		return &ErrSnapshotValidation{Input: test.Input, Output: string(stdOut)}
+	}
+	return
+}
@@ -0,0 +1,53 @@
+/*******************************************************************************
+ * Test: Service: maxima snapshot validation
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// createTestSnapshot creates a fake snapshot executable which evaluates its input by a shell script
+func createTestSnapshot(t *testing.T, stackVersion string, script string) {
+	err := os.WriteFile(path.Join(viper.GetString("storage.data"), "maxima-"+stackVersion), []byte("#!/bin/sh\n"+script+"\n"), 0755)
+	require.NoError(t, err)
+}
+
+func Test_maximaSnapshotValidate(t *testing.T) {
+	viper.Set("job.user", nil)
+	viper.Set("job.timeout", 10*time.Second)
+	viper.Set("storage.workspace", t.TempDir())
+	viper.Set("storage.data", t.TempDir())
+
+	createTestSnapshot(t, "2023010400", "cat")
+	createTestSnapshot(t, "2023060500", "exit 1")
+
+	tests := []struct {
+		name         string
+		stackVersion string
+		tests        []map[string]string
+		wantErr      bool
+	}{
+		{"no tests", "2023010400", nil, false},
+		{"matching output", "2023010400", []map[string]string{{"input": "1+1;", "expected": `^1\+1;$`}}, false},
+		{"unexpected output", "2023010400", []map[string]string{{"input": "1+1;", "expected": "^2$"}}, true},
+		{"invalid expression", "2023010400", []map[string]string{{"input": "1+1;", "expected": "("}}, true},
+		{"broken snapshot", "2023060500", []map[string]string{{"input": "1+1;", "expected": ""}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("maxima.validation.tests", tt.tests)
+			assert.Equal(t, tt.wantErr, maximaSnapshotValidate(tt.stackVersion) != nil)
+		})
+	}
+}
@@ -0,0 +1,44 @@
+/*******************************************************************************
+ * Service: maxima versions
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"cmp"
+	"github.com/spf13/viper"
+	"slices"
+)
+
+// MaximaVersions returns all versions which serve jobs, sorted from oldest to newest, and the version of jobs
+// without a requested or with an unknown version
+func MaximaVersions() (resp *models.MaximaVersionsResponse, err error) {
+	defaultVersion, err := MaximaSnapshotGet("")
+	if err != nil {
+		return
+	}
+
+	maximaSnapshotMutex.RLock()
+	defer maximaSnapshotMutex.RUnlock()
+
+	resp = &models.MaximaVersionsResponse{Default: defaultVersion, Versions: []models.MaximaVersion{}}
+	force := viper.GetBool("maxima.validation.force")
+	for _, item := range maximaSnapshotList {
+		if item.Usable(force) {
+			aliases := slices.Clone(item.Tags)
+			if aliases == nil {
+				aliases = []string{}
+			}
+			resp.Versions = append(resp.Versions, models.MaximaVersion{Version: item.Version, Aliases: aliases, Deprecated: item.Deprecated})
+		}
+	}
+
+	slices.SortFunc(resp.Versions, func(a, b models.MaximaVersion) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return
+}
@@ -0,0 +1,49 @@
+/*******************************************************************************
+ * Test: Service: maxima versions
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestMaximaVersions(t *testing.T) {
+	viper.Set("maxima.validation.force", false)
+	maximaSnapshotList = models.MaximaSnapshotList{
+		{Version: "2024010100", Tags: []string{"v4.9.0"}, Healthy: true},
+		{Version: "2023010400", Tags: []string{"v4.7.0", "v4.7.1"}, Healthy: true, Deprecated: true},
+		{Version: "2023060500", Tags: []string{"v4.8.0"}, Healthy: false},
+		{Version: "2023121100", Healthy: true, Disabled: true},
+		{Version: "2022120100", Healthy: true},
+	}
+	defer func() {
+		maximaSnapshotList = nil
+	}()
+
+	got, err := MaximaVersions()
+	require.NoError(t, err)
+	assert.Equal(t, &models.MaximaVersionsResponse{
+		Default: "2022120100",
+		Versions: []models.MaximaVersion{
+			{Version: "2022120100", Aliases: []string{}},
+			{Version: "2023010400", Aliases: []string{"v4.7.0", "v4.7.1"}, Deprecated: true},
+			{Version: "2024010100", Aliases: []string{"v4.9.0"}},
+		},
+	}, got)
+
+	gotVersion, err := MaximaSnapshotGet("v4.7.1")
+	require.NoError(t, err)
+	assert.Equal(t, "2023010400", gotVersion)
+
+	maximaSnapshotList = models.MaximaSnapshotList{{Version: "2023060500", Healthy: false}}
+	_, err = MaximaVersions()
+	assert.Error(t, err)
+}
@@ -0,0 +1,71 @@
+/*******************************************************************************
+ * Service: metrics
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	metricJobs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "maxima_pool",
+		Name:      "jobs_total",
+		Help:      "Number of jobs by outcome.",
+	}, []string{"outcome"})
+
+	metricJobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "maxima_pool",
+		Name:      "job_duration_seconds",
+		Help:      "Runtime of jobs by snapshot version.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 4, 8, 16, 32, 64},
+	}, []string{"version"})
+
+	metricJobQueue = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "maxima_pool",
+		Name:      "job_queue_depth",
+		Help:      "Number of jobs waiting for a free slot.",
+	})
+
+	metricJobQueueWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "maxima_pool",
+		Name:      "job_queue_wait_seconds",
+		Help:      "Time jobs waited for a free slot by priority.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2, 4, 8, 16, 32},
+	}, []string{"priority"})
+
+	metricJobPlots = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "maxima_pool",
+		Name:      "job_plots_total",
+		Help:      "Number of plots generated by jobs.",
+	})
+
+	metricJobOutput = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "maxima_pool",
+		Name:      "job_output_bytes_total",
+		Help:      "Size of all job responses in bytes.",
+	})
+
+	metricProcesses = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "maxima_pool",
+		Name:      "processes_running",
+		Help:      "Number of running maxima processes.",
+	})
+
+	metricClientLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "maxima_pool",
+		Name:      "client_limited_total",
+		Help:      "Number of jobs rejected by rate limits or quotas of their client.",
+	}, []string{"limit"})
+
+	metricSnapshotBuilds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "maxima_pool",
+		Name:      "snapshot_builds_total",
+		Help:      "Number of snapshot builds by result.",
+	}, []string{"result"})
+)
@@ -0,0 +1,271 @@
+/*******************************************************************************
+ * Service: job queue
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"context"
+	"github.com/spf13/viper"
+	"slices"
+	"sync"
+	"time"
+)
+
+// jobScheduler admits jobs into `job.concurrency` slots. Jobs of the highest priority go first, where waiting jobs
+// rise by one priority every `ageing`. Among these, clients are served by deficit round-robin, so every client gets
+// slots in proportion to its weight.
+type jobScheduler struct {
+	mutex    sync.Mutex
+	capacity int
+	ageing   time.Duration
+	running  int
+	waiting  int
+	queues   map[string]*jobClientQueue
+	active   []string
+	next     int
+}
+
+type jobClientQueue struct {
+	tickets     []*jobTicket
+	running     int
+	deficit     float64
+	weight      float64
+	maxInFlight int
+}
+
+type jobTicket struct {
+	client   string
+	priority int
+	enqueued time.Time
+	ready    chan struct{}
+	granted  bool
+}
+
+var (
+	jobSlots      *jobScheduler
+	jobSlotsMutex sync.Mutex
+)
+
+// jobQueueAcquire waits for one of `job.concurrency` slots, where a limit below one means unlimited slots, and for
+// the client to be below its maximum of jobs in flight
+func jobQueueAcquire(ctx context.Context, client string, priority string) (release func(), err error) {
+	if err = ctx.Err(); err != nil {
+		return func() {}, err
+	}
+	scheduler := jobSchedulerGet()
+
+	start := time.Now()
+	ticket, granted := scheduler.enqueue(client, slices.Index(models.JobPriorities, priority))
+	defer func() {
+		if err == nil {
+			metricJobQueueWait.WithLabelValues(priority).Observe(time.Since(start).Seconds())
+		}
+	}()
+	if !granted {
+		metricJobQueue.Inc()
+		defer metricJobQueue.Dec()
+
+		select {
+		case <-ticket.ready:
+		case <-ctx.Done():
+			if !scheduler.cancel(ticket) {
+				return func() {}, ctx.Err()
+			}
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			scheduler.release(client)
+		})
+	}, nil
+}
+
+func jobSchedulerGet() *jobScheduler {
+	jobSlotsMutex.Lock()
+	defer jobSlotsMutex.Unlock()
+
+	if jobSlots == nil {
+		jobSlots = &jobScheduler{
+			capacity: viper.GetInt("job.concurrency"),
+			ageing:   viper.GetDuration("job.priority_ageing"),
+			queues:   make(map[string]*jobClientQueue),
+		}
+	}
+	return jobSlots
+}
+
+// enqueue adds a ticket of the client with the index of its priority, which is granted immediately if a slot is free
+func (s *jobScheduler) enqueue(client string, priority int) (*jobTicket, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	queue, ok := s.queues[client]
+	if !ok {
+		limits := clientLimitsFor(client)
+		queue = &jobClientQueue{weight: limits.Weight, maxInFlight: limits.MaxInFlight}
+		if queue.weight <= 0 {
+			queue.weight = 1
+		}
+		s.queues[client] = queue
+	}
+
+	ticket := &jobTicket{client: client, priority: priority, enqueued: time.Now(), ready: make(chan struct{})}
+	queue.tickets = append(queue.tickets, ticket)
+	if len(queue.tickets) == 1 {
+		s.active = append(s.active, client)
+		if len(s.active) == 1 {
+			s.next = 0
+			queue.deficit = queue.weight
+		}
+	}
+	s.waiting++
+
+	s.dispatch()
+	return ticket, ticket.granted
+}
+
+// cancel removes a waiting ticket and returns whether it was granted in the meantime
+func (s *jobScheduler) cancel(ticket *jobTicket) (granted bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if ticket.granted {
+		return true
+	}
+
+	queue := s.queues[ticket.client]
+	queue.tickets = slices.DeleteFunc(queue.tickets, func(item *jobTicket) bool { return item == ticket })
+	s.waiting--
+	if len(queue.tickets) == 0 {
+		s.deactivate(ticket.client)
+	}
+	s.cleanup(ticket.client)
+	return false
+}
+
+// release frees the slot of a job of the client
+func (s *jobScheduler) release(client string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.running--
+	s.queues[client].running--
+	s.cleanup(client)
+	s.dispatch()
+}
+
+// dispatch grants tickets while slots are free; the caller must hold the mutex
+func (s *jobScheduler) dispatch() {
+	for s.capacity <= 0 || s.running < s.capacity {
+		now := time.Now()
+		top := -1
+		for _, client := range s.active {
+			if queue := s.queues[client]; queue.eligible() {
+				top = max(top, queue.tickets[queue.best(now, s.ageing)].effective(now, s.ageing))
+			}
+		}
+		if top < 0 {
+			return
+		}
+		candidate := func(queue *jobClientQueue) bool {
+			return queue.eligible() && queue.tickets[queue.best(now, s.ageing)].effective(now, s.ageing) == top
+		}
+
+		// Visiting a client adds its weight to its deficit, serving a job costs one
+		queue := s.queues[s.active[s.next]]
+		for !candidate(queue) || queue.deficit < 1 {
+			s.next = (s.next + 1) % len(s.active)
+			queue = s.queues[s.active[s.next]]
+			if candidate(queue) {
+				queue.deficit += queue.weight
+			}
+		}
+
+		i := queue.best(now, s.ageing)
+		ticket := queue.tickets[i]
+		queue.tickets = slices.Delete(queue.tickets, i, i+1)
+		queue.deficit--
+		queue.running++
+		s.running++
+		s.waiting--
+		ticket.granted = true
+		close(ticket.ready)
+
+		if len(queue.tickets) == 0 {
+			s.deactivate(ticket.client)
+		}
+	}
+}
+
+// deactivate removes a client without waiting jobs from the round; the caller must hold the mutex
+func (s *jobScheduler) deactivate(client string) {
+	i := slices.Index(s.active, client)
+	s.active = slices.Delete(s.active, i, i+1)
+	s.queues[client].deficit = 0
+	if i < s.next {
+		s.next--
+		return
+	}
+	current := i == s.next
+	if s.next >= len(s.active) {
+		s.next = 0
+	}
+
+	// The round moves on to the next client
+	if current && len(s.active) > 0 {
+		if queue := s.queues[s.active[s.next]]; queue.eligible() {
+			queue.deficit += queue.weight
+		}
+	}
+}
+
+// cleanup forgets an idle client; the caller must hold the mutex
+func (s *jobScheduler) cleanup(client string) {
+	if queue := s.queues[client]; queue.running == 0 && len(queue.tickets) == 0 {
+		delete(s.queues, client)
+	}
+}
+
+// best returns the index of the ticket with the highest effective priority, the oldest one if several are equal
+func (q *jobClientQueue) best(now time.Time, ageing time.Duration) (best int) {
+	for i := range q.tickets {
+		if q.tickets[i].effective(now, ageing) > q.tickets[best].effective(now, ageing) {
+			best = i
+		}
+	}
+	return
+}
+
+// effective is the index of the priority raised by the time the ticket has been waiting
+func (t *jobTicket) effective(now time.Time, ageing time.Duration) int {
+	if ageing <= 0 {
+		return t.priority
+	}
+	return min(len(models.JobPriorities)-1, t.priority+int(now.Sub(t.enqueued)/ageing))
+}
+
+func (q *jobClientQueue) eligible() bool {
+	return len(q.tickets) > 0 && (q.maxInFlight <= 0 || q.running < q.maxInFlight)
+}
+
+// JobQueueState returns the number of running and waiting jobs and the number of slots (zero without a limit)
+func JobQueueState() (running int, waiting int, capacity int) {
+	jobSlotsMutex.Lock()
+	scheduler := jobSlots
+	jobSlotsMutex.Unlock()
+
+	if scheduler == nil {
+		return 0, 0, max(0, viper.GetInt("job.concurrency"))
+	}
+
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	return scheduler.running, scheduler.waiting, max(0, scheduler.capacity)
+}
@@ -0,0 +1,197 @@
+/*******************************************************************************
+ * Test: Service: job queue
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"context"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_jobScheduler_order(t *testing.T) {
+	viper.Set("limits.clients", []map[string]any{{"name": "heavy", "weight": 2}})
+	resetClientLimits()
+	defer func() {
+		viper.Set("limits.clients", nil)
+		resetClientLimits()
+	}()
+
+	tests := []struct {
+		name    string
+		clients []string
+		want    []string
+	}{
+		{"round-robin", []string{"a", "a", "a", "a", "b", "b", "c"}, []string{"a", "b", "c", "a", "b", "a", "a"}},
+		{"weighted", []string{"heavy", "heavy", "heavy", "heavy", "b", "b", "b"}, []string{"heavy", "heavy", "b", "heavy", "heavy", "b", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduler := &jobScheduler{capacity: 1, queues: make(map[string]*jobClientQueue)}
+
+			// All jobs wait behind a running one, so their order of arrival does not matter
+			_, granted := scheduler.enqueue("blocker", 1)
+			require.True(t, granted)
+			var tickets []*jobTicket
+			for _, client := range tt.clients {
+				ticket, _ := scheduler.enqueue(client, 1)
+				tickets = append(tickets, ticket)
+			}
+
+			// Each finished job hands its slot to the next one
+			var got []string
+			seen := make(map[*jobTicket]bool)
+			running := "blocker"
+			for range tickets {
+				scheduler.release(running)
+				for _, ticket := range tickets {
+					if ticket.granted && !seen[ticket] {
+						seen[ticket] = true
+						running = ticket.client
+						got = append(got, running)
+					}
+				}
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Zero(t, scheduler.waiting)
+		})
+	}
+}
+
+func Test_jobScheduler_maxInFlight(t *testing.T) {
+	viper.Set("limits.clients", []map[string]any{{"name": "limited", "max_in_flight": 1}})
+	resetClientLimits()
+	defer func() {
+		viper.Set("limits.clients", nil)
+		resetClientLimits()
+	}()
+
+	scheduler := &jobScheduler{capacity: 3, queues: make(map[string]*jobClientQueue)}
+	first, _ := scheduler.enqueue("limited", 1)
+	second, _ := scheduler.enqueue("limited", 1)
+	other, _ := scheduler.enqueue("other", 1)
+
+	// A free slot is not used by a client at its limit
+	assert.True(t, first.granted)
+	assert.False(t, second.granted)
+	assert.True(t, other.granted)
+	assert.Equal(t, 2, scheduler.running)
+
+	scheduler.release("limited")
+	assert.True(t, second.granted)
+
+	// A cancelled ticket leaves the queue
+	third, _ := scheduler.enqueue("limited", 1)
+	assert.False(t, scheduler.cancel(third))
+	assert.Zero(t, scheduler.waiting)
+	scheduler.release("limited")
+	scheduler.release("other")
+	assert.Zero(t, scheduler.running)
+	assert.Empty(t, scheduler.queues)
+}
+
+// TestJobQueue_fairness simulates a heavy client, which saturates all slots with a backlog of jobs, and a light client
+// sending single jobs; the light client waits at most for one job to finish instead of the whole backlog
+func TestJobQueue_fairness(t *testing.T) {
+	viper.Set("job.concurrency", 2)
+	jobSlots = nil
+	resetClientLimits()
+	defer func() {
+		jobSlots = nil
+		resetClientLimits()
+	}()
+
+	const jobDuration = 20 * time.Millisecond
+	var heavy sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		heavy.Add(1)
+		go func() {
+			defer heavy.Done()
+			release, err := jobQueueAcquire(context.Background(), "heavy", models.JobPriorityNormal)
+			require.NoError(t, err)
+			time.Sleep(jobDuration)
+			release()
+		}()
+	}
+	require.Eventually(t, func() bool {
+		running, waiting, _ := JobQueueState()
+		return running == 2 && waiting == 38
+	}, time.Second, time.Millisecond)
+
+	var maxLatency time.Duration
+	for i := 0; i < 5; i++ {
+		start := time.Now()
+		release, err := jobQueueAcquire(context.Background(), "light", models.JobPriorityNormal)
+		require.NoError(t, err)
+		maxLatency = max(maxLatency, time.Since(start))
+		time.Sleep(jobDuration)
+		release()
+	}
+	heavy.Wait()
+
+	// First come, first served would delay the light client by the backlog of 19 jobs per slot
+	assert.Less(t, maxLatency, 5*jobDuration, "latency of the light client")
+	running, waiting, _ := JobQueueState()
+	assert.Zero(t, running)
+	assert.Zero(t, waiting)
+}
+
+func Test_jobScheduler_priority(t *testing.T) {
+	resetClientLimits()
+	defer resetClientLimits()
+
+	type item struct {
+		client   string
+		priority int
+		waited   time.Duration
+	}
+	tests := []struct {
+		name   string
+		ageing time.Duration
+		items  []item
+		want   []string
+	}{
+		{"by priority", 0, []item{{"a", 0, 0}, {"b", 1, 0}, {"c", 2, 0}, {"a", 0, 0}}, []string{"c", "b", "a", "a"}},
+		{"ageing disabled", 0, []item{{"a", 0, time.Hour}, {"b", 1, 0}}, []string{"b", "a"}},
+		{"aged low priority", time.Minute, []item{{"a", 0, 2 * time.Minute}, {"b", 1, 0}}, []string{"a", "b"}},
+		{"partly aged low priority", time.Minute, []item{{"a", 0, time.Minute}, {"b", 2, 0}}, []string{"b", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduler := &jobScheduler{capacity: 1, ageing: tt.ageing, queues: make(map[string]*jobClientQueue)}
+			_, granted := scheduler.enqueue("blocker", 1)
+			require.True(t, granted)
+
+			var tickets []*jobTicket
+			for _, item := range tt.items {
+				ticket, _ := scheduler.enqueue(item.client, item.priority)
+				ticket.enqueued = ticket.enqueued.Add(-item.waited)
+				tickets = append(tickets, ticket)
+			}
+
+			var got []string
+			seen := make(map[*jobTicket]bool)
+			running := "blocker"
+			for range tickets {
+				scheduler.release(running)
+				for _, ticket := range tickets {
+					if ticket.granted && !seen[ticket] {
+						seen[ticket] = true
+						running = ticket.client
+						got = append(got, running)
+					}
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
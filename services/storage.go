@@ -0,0 +1,121 @@
+/*******************************************************************************
+ * Service: storage
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"fmt"
+	"github.com/spf13/viper"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sync"
+)
+
+type ErrUnknownStorage string
+
+func (e ErrUnknownStorage) Error() string {
+	return "unknown storage backend " + string(e)
+}
+
+var (
+	storageRemote      models.Storage
+	storageRemoteMutex sync.Mutex
+)
+
+// Storage returns the snapshot storage configured by `storage.backend`
+func Storage() (models.Storage, error) {
+	switch backend := viper.GetString("storage.backend"); backend {
+	case "", "local":
+		return &storageLocal{root: viper.GetString("storage.data")}, nil
+	case "s3":
+		storageRemoteMutex.Lock()
+		defer storageRemoteMutex.Unlock()
+
+		if storageRemote == nil {
+			storage, err := newStorageS3()
+			if err != nil {
+				return nil, err
+			}
+			storageRemote = storage
+		}
+		return storageRemote, nil
+	default:
+		return nil, ErrUnknownStorage(backend)
+	}
+}
+
+// storageLocal stores objects as files of a directory on local disk
+type storageLocal struct {
+	root string
+}
+
+func (s *storageLocal) List() (names []string, err error) {
+	dir, err := os.ReadDir(s.root)
+	if err != nil {
+		return
+	}
+
+	for _, item := range dir {
+		if item.Type().IsRegular() {
+			names = append(names, item.Name())
+		}
+	}
+	return
+}
+
+func (s *storageLocal) Open(name string) (io.ReadCloser, error) {
+	return os.Open(path.Join(s.root, name))
+}
+
+// Put writes the object into a temporary file first, so running snapshots are never modified
+func (s *storageLocal) Put(name string, r io.Reader, size int64, mode fs.FileMode) (err error) {
+	return storageWriteFile(path.Join(s.root, name), r, size, mode)
+}
+
+func (s *storageLocal) Remove(name string) error {
+	return os.Remove(path.Join(s.root, name))
+}
+
+func (s *storageLocal) Local(name string) (string, error) {
+	filePath := path.Join(s.root, name)
+	if _, err := os.Stat(filePath); err != nil {
+		return "", err
+	}
+	return filePath, nil
+}
+
+// storageWriteFile atomically replaces a file by size bytes of the reader
+func storageWriteFile(filePath string, r io.Reader, size int64, mode fs.FileMode) (err error) {
+	file, err := os.CreateTemp(path.Dir(filePath), "."+path.Base(filePath)+"-")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(file.Name())
+		}
+	}()
+
+	written, err := io.Copy(file, r)
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return
+	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("wrote %d of %d bytes of %s", written, size, filePath)
+	}
+
+	if err = os.Chmod(file.Name(), mode); err != nil {
+		return
+	}
+	return os.Rename(file.Name(), filePath)
+}
@@ -0,0 +1,222 @@
+/*******************************************************************************
+ * Service: S3-compatible storage
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/spf13/viper"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// storageS3 stores objects in a bucket of an S3-compatible object store. Snapshots are fetched on first use and
+// cached in `storage.data` with their ETag; a cached copy is compared with the object every `storage.s3.revalidate`,
+// so objects replaced by another node are fetched again.
+type storageS3 struct {
+	client     *minio.Client
+	bucket     string
+	prefix     string
+	cache      string
+	revalidate time.Duration
+	validated  map[string]time.Time
+	locks      map[string]*sync.RWMutex
+	mutex      sync.Mutex
+}
+
+func newStorageS3() (*storageS3, error) {
+	client, err := minio.New(viper.GetString("storage.s3.endpoint"), &minio.Options{
+		Creds:  credentials.NewStaticV4(viper.GetString("storage.s3.access_key"), viper.GetString("storage.s3.secret_key"), ""),
+		Secure: viper.GetBool("storage.s3.secure"),
+		Region: viper.GetString("storage.s3.region"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &storageS3{
+		client:     client,
+		bucket:     viper.GetString("storage.s3.bucket"),
+		prefix:     viper.GetString("storage.s3.prefix"),
+		cache:      viper.GetString("storage.data"),
+		revalidate: viper.GetDuration("storage.s3.revalidate"),
+		validated:  make(map[string]time.Time),
+		locks:      make(map[string]*sync.RWMutex),
+	}, nil
+}
+
+func (s *storageS3) List() (names []string, err error) {
+	for item := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{Prefix: s.prefix, Recursive: true}) {
+		if item.Err != nil {
+			return nil, item.Err
+		}
+		names = append(names, strings.TrimPrefix(item.Key, s.prefix))
+	}
+	return
+}
+
+func (s *storageS3) Open(name string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(context.Background(), s.bucket, s.prefix+name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s.error(name, err)
+	}
+
+	// Requests are sent lazily, so force a request to detect missing objects
+	if _, err = object.Stat(); err != nil {
+		_ = object.Close()
+		return nil, s.error(name, err)
+	}
+	return object, nil
+}
+
+func (s *storageS3) Put(name string, r io.Reader, size int64, _ fs.FileMode) error {
+	_, err := s.client.PutObject(context.Background(), s.bucket, s.prefix+name, r, size, minio.PutObjectOptions{ContentType: "application/octet-stream"})
+	if err != nil {
+		return err
+	}
+
+	lock := s.lock(name)
+	lock.Lock()
+	defer lock.Unlock()
+	return s.evict(name)
+}
+
+func (s *storageS3) Remove(name string) error {
+	if err := s.client.RemoveObject(context.Background(), s.bucket, s.prefix+name, minio.RemoveObjectOptions{}); err != nil {
+		return s.error(name, err)
+	}
+
+	lock := s.lock(name)
+	lock.Lock()
+	defer lock.Unlock()
+	return s.evict(name)
+}
+
+func (s *storageS3) Local(name string) (string, error) {
+	filePath := path.Join(s.cache, name)
+
+	// A recently validated copy is served under the read lock, so it isn't evicted meanwhile
+	lock := s.lock(name)
+	lock.RLock()
+	if s.isValid(name) {
+		lock.RUnlock()
+		return filePath, nil
+	}
+	lock.RUnlock()
+
+	// Objects are fetched one at a time per name, but different objects in parallel
+	lock.Lock()
+	defer lock.Unlock()
+
+	// Another request may have fetched or validated the object in the meantime
+	if s.isValid(name) {
+		return filePath, nil
+	}
+
+	if etag, err := os.ReadFile(s.etagPath(name)); err == nil {
+		if _, errStat := os.Stat(filePath); errStat == nil {
+			info, errStat := s.client.StatObject(context.Background(), s.bucket, s.prefix+name, minio.StatObjectOptions{})
+			switch {
+			case errStat == nil && info.ETag == string(etag):
+				s.validate(name)
+				return filePath, nil
+			case errStat != nil && !errors.Is(s.error(name, errStat), fs.ErrNotExist):
+				// Keep serving the cached copy while the object store is unavailable
+				return filePath, nil
+			}
+		}
+	}
+	if err := s.evict(name); err != nil {
+		return "", err
+	}
+
+	object, err := s.client.GetObject(context.Background(), s.bucket, s.prefix+name, minio.GetObjectOptions{})
+	if err != nil {
+		return "", s.error(name, err)
+	}
+	defer func(object *minio.Object) {
+		_ = object.Close()
+	}(object)
+	info, err := object.Stat()
+	if err != nil {
+		return "", s.error(name, err)
+	}
+
+	if err = storageWriteFile(filePath, object, info.Size, 0755); err != nil {
+		return "", err
+	}
+	if err = os.WriteFile(s.etagPath(name), []byte(info.ETag), 0644); err != nil {
+		return "", err
+	}
+	s.validate(name)
+	return filePath, nil
+}
+
+// lock returns the lock guarding the cached copy of an object
+func (s *storageS3) lock(name string) *sync.RWMutex {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	lock := s.locks[name]
+	if lock == nil {
+		lock = &sync.RWMutex{}
+		s.locks[name] = lock
+	}
+	return lock
+}
+
+// isValid is true if the cached copy of an object was validated within `storage.s3.revalidate`
+func (s *storageS3) isValid(name string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	validated, ok := s.validated[name]
+	return ok && time.Since(validated) < s.revalidate
+}
+
+// validate remembers that the cached copy of an object matches the object
+func (s *storageS3) validate(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.validated[name] = time.Now()
+}
+
+// etagPath returns the path of the ETag of a cached object
+func (s *storageS3) etagPath(name string) string {
+	return path.Join(s.cache, "."+name+".etag")
+}
+
+// evict removes the cached copy of an object and its ETag; the caller must hold the object's lock
+func (s *storageS3) evict(name string) error {
+	s.mutex.Lock()
+	delete(s.validated, name)
+	s.mutex.Unlock()
+
+	for _, filePath := range []string{s.etagPath(name), path.Join(s.cache, name)} {
+		if err := os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// error reports missing objects as fs.ErrNotExist
+func (s *storageS3) error(name string, err error) error {
+	if code := minio.ToErrorResponse(err).Code; code == "NoSuchKey" || code == "NoSuchBucket" {
+		return fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+	}
+	return err
+}
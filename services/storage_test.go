@@ -0,0 +1,224 @@
+/*******************************************************************************
+ * Test: Service: storage
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testS3Server is an in-process stand-in for an S3-compatible object store with a single bucket
+type testS3Server struct {
+	bucket  string
+	objects map[string][]byte
+	gets    map[string]int
+	mutex   sync.Mutex
+}
+
+func (s *testS3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.bucket {
+		s.error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		type content struct {
+			Key  string
+			Size int
+		}
+		result := struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Name     string
+			Prefix   string
+			KeyCount int
+			Contents []content
+		}{Name: s.bucket, Prefix: r.URL.Query().Get("prefix")}
+		for name, data := range s.objects {
+			if strings.HasPrefix(name, result.Prefix) {
+				result.Contents = append(result.Contents, content{name, len(data)})
+			}
+		}
+		sort.Slice(result.Contents, func(i, j int) bool {
+			return result.Contents[i].Key < result.Contents[j].Key
+		})
+		result.KeyCount = len(result.Contents)
+		w.Header().Set("Content-Type", "application/xml")
+		_ = xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, ok := s.objects[key]
+		if !ok {
+			s.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		if r.Method == http.MethodGet {
+			s.gets[key]++
+		}
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, md5.Sum(data)))
+		http.ServeContent(w, r, key, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), bytes.NewReader(data))
+	case r.Method == http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			s.error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		s.objects[key] = data
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, md5.Sum(data)))
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (s *testS3Server) error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte("<Error><Code>" + code + "</Code><Message>" + code + "</Message></Error>"))
+}
+
+func TestStorage(t *testing.T) {
+	viper.Set("job.user", nil)
+	viper.Set("storage.workspace", t.TempDir())
+
+	s3Server := &testS3Server{bucket: "maxima", objects: map[string][]byte{}, gets: map[string]int{}}
+	httpServer := httptest.NewServer(s3Server)
+	defer httpServer.Close()
+
+	tests := []struct {
+		name    string
+		backend string
+	}{
+		{"local storage", "local"},
+		{"s3 storage", "s3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("storage.backend", tt.backend)
+			viper.Set("storage.data", t.TempDir())
+			viper.Set("storage.s3.endpoint", strings.TrimPrefix(httpServer.URL, "http://"))
+			viper.Set("storage.s3.secure", false)
+			viper.Set("storage.s3.region", "us-east-1")
+			viper.Set("storage.s3.bucket", "maxima")
+			viper.Set("storage.s3.prefix", "pool/")
+			storageRemote = nil
+			defer func() {
+				viper.Set("storage.backend", nil)
+				storageRemote = nil
+			}()
+
+			storage, err := Storage()
+			require.NoError(t, err)
+
+			// Missing objects
+			_, err = storage.Open("maxima-2023010400")
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+			_, err = storage.Local("maxima-2023010400")
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+
+			// Stored objects
+			snapshot := "#!/bin/sh\necho TEST\n"
+			require.NoError(t, storage.Put("maxima-2023010400", strings.NewReader(snapshot), int64(len(snapshot)), 0755))
+			require.NoError(t, storage.Put(models.MaximaSnapshotListFile, strings.NewReader("LIST"), 4, 0644))
+
+			names, err := storage.List()
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{"maxima-2023010400", models.MaximaSnapshotListFile}, names)
+
+			file, err := storage.Open(models.MaximaSnapshotListFile)
+			require.NoError(t, err)
+			data, err := io.ReadAll(file)
+			require.NoError(t, err)
+			require.NoError(t, file.Close())
+			assert.Equal(t, "LIST", string(data))
+
+			// Executable copies on local disk
+			for i := 0; i < 2; i++ {
+				filePath, err := storage.Local("maxima-2023010400")
+				require.NoError(t, err)
+				assert.Equal(t, path.Join(viper.GetString("storage.data"), "maxima-2023010400"), filePath)
+
+				stdOut, _, _, clean, err := CommandCreate(context.Background(), 10*time.Second, "", filePath)
+				clean()
+				require.NoError(t, err)
+				assert.Equal(t, "TEST\n", string(stdOut))
+			}
+			if tt.backend == "s3" {
+				assert.Equal(t, 1, s3Server.gets["pool/maxima-2023010400"], "snapshot is fetched once")
+			}
+
+			// Replaced objects
+			snapshot = "#!/bin/sh\necho NEW\n"
+			require.NoError(t, storage.Put("maxima-2023010400", strings.NewReader(snapshot), int64(len(snapshot)), 0755))
+			filePath, err := storage.Local("maxima-2023010400")
+			require.NoError(t, err)
+			data, err = os.ReadFile(filePath)
+			require.NoError(t, err)
+			assert.Equal(t, snapshot, string(data))
+
+			// Objects replaced by another node are fetched again after revalidation
+			if tt.backend == "s3" {
+				snapshot = "#!/bin/sh\necho OTHER\n"
+				s3Server.mutex.Lock()
+				s3Server.objects["pool/maxima-2023010400"] = []byte(snapshot)
+				s3Server.mutex.Unlock()
+				storage.(*storageS3).revalidate = 0
+				filePath, err = storage.Local("maxima-2023010400")
+				require.NoError(t, err)
+				data, err = os.ReadFile(filePath)
+				require.NoError(t, err)
+				assert.Equal(t, snapshot, string(data))
+			}
+
+			// Objects replaced while copies are served
+			var waitGroup sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				waitGroup.Add(2)
+				go func() {
+					defer waitGroup.Done()
+					_, err := storage.Local("maxima-2023010400")
+					assert.NoError(t, err)
+				}()
+				go func() {
+					defer waitGroup.Done()
+					assert.NoError(t, storage.Put("maxima-2023010400", strings.NewReader(snapshot), int64(len(snapshot)), 0755))
+				}()
+			}
+			waitGroup.Wait()
+
+			// Removed objects
+			require.NoError(t, storage.Remove("maxima-2023010400"))
+			_, err = storage.Open("maxima-2023010400")
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+			assert.NoFileExists(t, filePath)
+		})
+	}
+}
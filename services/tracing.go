@@ -0,0 +1,112 @@
+/*******************************************************************************
+ * Service: tracing
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	TracingExporterNone = "none"
+	TracingExporterOTLP = "otlp"
+	TracingExporterFile = "file"
+)
+
+type ErrUnknownTracingExporter string
+
+func (e ErrUnknownTracingExporter) Error() string {
+	return "unknown tracing exporter " + string(e)
+}
+
+// Tracer creates the spans of this service; it is a no-op until TracingStart configures an exporter
+func Tracer() trace.Tracer {
+	return otel.Tracer("Moodle_Maxima_Pool")
+}
+
+// TracingStart configures the exporter of `tracing.exporter` and returns a function which flushes all pending spans.
+// W3C trace context is propagated regardless of the exporter.
+func TracingStart() (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	shutdown = func(context.Context) error { return nil }
+
+	var exporter sdktrace.SpanExporter
+	switch exporterName := viper.GetString("tracing.exporter"); exporterName {
+	case TracingExporterNone, "":
+		return
+	case TracingExporterOTLP:
+		var endpoint *url.URL
+		if endpoint, err = url.Parse(viper.GetString("tracing.endpoint")); err != nil {
+			return
+		}
+		if strings.Trim(endpoint.Path, "/") == "" {
+			endpoint.Path = "/v1/traces"
+		}
+		if exporter, err = otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint.String())); err != nil {
+			return
+		}
+	case TracingExporterFile:
+		var file *os.File
+		if file, err = os.OpenFile(viper.GetString("tracing.file"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err != nil {
+			return
+		}
+		if exporter, err = stdouttrace.New(stdouttrace.WithWriter(file)); err != nil {
+			_ = file.Close()
+			return
+		}
+		exporter = &tracingFileExporter{SpanExporter: exporter, file: file}
+	default:
+		return shutdown, ErrUnknownTracingExporter(exporterName)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(viper.GetFloat64("tracing.sample_ratio")))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(viper.GetString("tracing.service_name")))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// tracingFileExporter closes the file of the exporter on shutdown
+type tracingFileExporter struct {
+	sdktrace.SpanExporter
+	file *os.File
+}
+
+func (e *tracingFileExporter) Shutdown(ctx context.Context) error {
+	err := e.SpanExporter.Shutdown(ctx)
+	if errClose := e.file.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
+
+// tracingEnd records the error of a span's operation and ends it
+func tracingEnd(span trace.Span, err error, attributes ...attribute.KeyValue) {
+	span.SetAttributes(attributes...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
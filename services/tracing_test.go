@@ -0,0 +1,148 @@
+/*******************************************************************************
+ * Test: Service: tracing
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package services
+
+import (
+	"Moodle_Maxima_Pool/models"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace/noop"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// testCollector is a stand-in of an OTLP/HTTP collector which records the names and trace IDs of all spans
+type testCollector struct {
+	mutex sync.Mutex
+	spans map[string][]byte
+}
+
+func (c *testCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	request := &collectortrace.ExportTraceServiceRequest{}
+	if err != nil || r.URL.Path != "/v1/traces" || proto.Unmarshal(body, request) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, resourceSpans := range request.ResourceSpans {
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			for _, span := range scopeSpans.Spans {
+				c.spans[span.Name] = span.TraceId
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(http.StatusOK)
+}
+
+// tracingTestJob runs a job as part of the upstream trace testTraceParent
+func tracingTestJob(t *testing.T) {
+	viper.Set("job.user", nil)
+	viper.Set("job.timeout", time.Second)
+	viper.Set("job.concurrency", 1)
+	viper.Set("storage.backend", "local")
+	viper.Set("storage.workspace", t.TempDir())
+	viper.Set("storage.data", t.TempDir())
+	maximaSnapshotList = models.MaximaSnapshotList{{Version: "2023010400", Healthy: true}}
+	jobSlots = nil
+	t.Cleanup(func() {
+		maximaSnapshotList = nil
+		jobSlots = nil
+	})
+	createTestSnapshot(t, "2023010400", "cat > /dev/null; touch plot-1.svg; echo OUTPUT")
+
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier{"traceparent": testTraceParent})
+	_, err := JobCreate(ctx, &models.JobRequestQuery{Input: "1+1;", Timeout: 30000})
+	require.NoError(t, err)
+}
+
+func TestTracingStart(t *testing.T) {
+	defer func() {
+		viper.Set("tracing.exporter", TracingExporterNone)
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	}()
+	viper.Set("tracing.sample_ratio", 1.0)
+	viper.Set("tracing.service_name", "maxima-pool")
+
+	wantSpans := []string{"job", "snapshot.resolve", "workspace.create", "process.start", "process.output", "output.package"}
+
+	t.Run("otlp", func(t *testing.T) {
+		collector := &testCollector{spans: make(map[string][]byte)}
+		server := httptest.NewServer(collector)
+		defer server.Close()
+
+		viper.Set("tracing.exporter", TracingExporterOTLP)
+		viper.Set("tracing.endpoint", server.URL)
+		shutdown, err := TracingStart()
+		require.NoError(t, err)
+
+		tracingTestJob(t)
+		require.NoError(t, shutdown(context.Background()))
+
+		for _, name := range wantSpans {
+			if assert.Contains(t, collector.spans, name) {
+				assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", hex.EncodeToString(collector.spans[name]))
+			}
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		filePath := path.Join(t.TempDir(), "traces.json")
+		viper.Set("tracing.exporter", TracingExporterFile)
+		viper.Set("tracing.file", filePath)
+		shutdown, err := TracingStart()
+		require.NoError(t, err)
+
+		tracingTestJob(t)
+		require.NoError(t, shutdown(context.Background()))
+
+		data, err := os.ReadFile(filePath)
+		require.NoError(t, err)
+
+		spans := make(map[string]string)
+		decoder := json.NewDecoder(strings.NewReader(string(data)))
+		for decoder.More() {
+			var span struct {
+				Name        string
+				SpanContext struct{ TraceID string }
+			}
+			require.NoError(t, decoder.Decode(&span))
+			spans[span.Name] = span.SpanContext.TraceID
+		}
+		for _, name := range wantSpans {
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[name], name)
+		}
+	})
+
+	t.Run("unknown exporter", func(t *testing.T) {
+		viper.Set("tracing.exporter", "jaeger")
+		_, err := TracingStart()
+		assert.Equal(t, ErrUnknownTracingExporter("jaeger"), err)
+	})
+}
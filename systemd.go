@@ -0,0 +1,112 @@
+/*******************************************************************************
+ * Integration with systemd: socket activation and service notifications
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package main
+
+import (
+	"Moodle_Maxima_Pool/services"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const systemdListenFDsStart = 3
+
+// systemdListeners returns the sockets passed by systemd's socket activation (`LISTEN_FDS`) in their order and their
+// names of `LISTEN_FDNAMES`; the variables are removed, so jobs do not inherit them
+func systemdListeners() (listeners []net.Listener, names []string, err error) {
+	defer func() {
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	if pid, errAtoi := strconv.Atoi(os.Getenv("LISTEN_PID")); errAtoi != nil || pid != os.Getpid() {
+		return
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil {
+		return
+	}
+	names = strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	names = append(names, make([]string, max(0, count-len(names)))...)[:count]
+
+	for fd := systemdListenFDsStart; fd < systemdListenFDsStart+count; fd++ {
+		// The listener uses a duplicate with close-on-exec, the original must not leak into jobs
+		file := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		listener, errListener := net.FileListener(file)
+		_ = file.Close()
+		if errListener != nil {
+			for _, opened := range listeners {
+				_ = opened.Close()
+			}
+			return nil, nil, errListener
+		}
+		listeners = append(listeners, listener)
+	}
+	return
+}
+
+// systemdNotify sends the states to the service manager of `NOTIFY_SOCKET`; it does nothing without one
+func systemdNotify(states ...string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer func(conn *net.UnixConn) {
+		_ = conn.Close()
+	}(conn)
+
+	_, err = conn.Write([]byte(strings.Join(states, "\n")))
+	return err
+}
+
+// systemdWatchdogInterval returns half of the watchdog timeout of the service manager or zero if it is disabled
+func systemdWatchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// systemdStatus describes the drain state and the number of jobs
+func systemdStatus() string {
+	state := services.DrainState()
+	if state.Draining {
+		return fmt.Sprintf("STATUS=draining, %d jobs left", state.Jobs)
+	}
+	return fmt.Sprintf("STATUS=serving, %d jobs", state.Jobs)
+}
+
+// startSystemdNotify reports the server as ready and keeps the watchdog of the service manager alive
+func startSystemdNotify() {
+	logSystemdNotify(systemdNotify("READY=1", fmt.Sprintf("MAINPID=%d", os.Getpid()), systemdStatus()))
+
+	if interval := systemdWatchdogInterval(); interval > 0 {
+		startPeriodicTask(interval, false, func() {
+			logSystemdNotify(systemdNotify("WATCHDOG=1", systemdStatus()))
+		})
+	}
+}
+
+func logSystemdNotify(err error) {
+	if err != nil {
+		logger.Warnf("notification of systemd failed: %s", err)
+	}
+}
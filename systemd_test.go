@@ -0,0 +1,72 @@
+/*******************************************************************************
+ * Test: systemd
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_systemdNotify(t *testing.T) {
+	socketPath := path.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	require.NoError(t, err)
+	defer func(conn *net.UnixConn) {
+		_ = conn.Close()
+	}(conn)
+
+	t.Setenv("NOTIFY_SOCKET", socketPath)
+	require.NoError(t, systemdNotify("READY=1", "STATUS=serving, 0 jobs"))
+
+	message := make([]byte, 256)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, err := conn.Read(message)
+	require.NoError(t, err)
+	assert.Equal(t, "READY=1\nSTATUS=serving, 0 jobs", string(message[:n]))
+
+	t.Setenv("NOTIFY_SOCKET", "")
+	assert.NoError(t, systemdNotify("READY=1"))
+}
+
+func Test_systemdWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		name string
+		usec string
+		pid  string
+		want time.Duration
+	}{
+		{"disabled", "", "", 0},
+		{"enabled", "30000000", "", 15 * time.Second},
+		{"own process", "30000000", strconv.Itoa(os.Getpid()), 15 * time.Second},
+		{"other process", "30000000", "1", 0},
+		{"invalid", "30s", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+			assert.Equal(t, tt.want, systemdWatchdogInterval())
+		})
+	}
+}
+
+func Test_systemdListeners_otherProcess(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+
+	listeners, _, err := systemdListeners()
+	assert.NoError(t, err)
+	assert.Empty(t, listeners)
+	assert.Empty(t, os.Getenv("LISTEN_FDS"))
+}
@@ -0,0 +1,156 @@
+/*******************************************************************************
+ * TLS of the HTTP listener
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/spf13/viper"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	tlsClientAuthNone     = "none"
+	tlsClientAuthOptional = "optional"
+	tlsClientAuthRequire  = "require"
+)
+
+var (
+	errTLSClientAuth = errors.New("server.tls.client_auth has to be none, optional or require")
+	errTLSClientCA   = errors.New("server.tls.client_ca contains no PEM certificate")
+	errTLSNoClientCA = errors.New("server.tls.client_auth requires server.tls.client_ca")
+	tlsCurrent       atomic.Pointer[tlsState]
+	tlsMutex         sync.Mutex
+)
+
+// tlsState is a loaded configuration and the modification times of its files
+type tlsState struct {
+	config   *tls.Config
+	modified []time.Time
+}
+
+func tlsEnabled() bool {
+	return viper.GetString("server.tls.cert") != ""
+}
+
+// newTLSConfig loads the certificate of `server.tls` and returns the configuration of the listener, which always
+// serves the last successfully loaded certificate and client CA
+func newTLSConfig() (*tls.Config, error) {
+	if _, err := reloadTLS(true); err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return tlsCurrent.Load().config, nil
+		},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &tlsCurrent.Load().config.Certificates[0], nil
+		},
+	}, nil
+}
+
+// reloadTLS loads the certificate, its key and the client CA again if one of them was modified or the reload is forced
+func reloadTLS(force bool) (reloaded bool, err error) {
+	tlsMutex.Lock()
+	defer tlsMutex.Unlock()
+
+	files := []string{viper.GetString("server.tls.cert"), viper.GetString("server.tls.key"), viper.GetString("server.tls.client_ca")}
+	modified := make([]time.Time, len(files))
+	for i, file := range files {
+		if file == "" {
+			continue
+		}
+		info, errStat := os.Stat(file)
+		if errStat != nil {
+			return false, errStat
+		}
+		modified[i] = info.ModTime()
+	}
+	if current := tlsCurrent.Load(); !force && current != nil && slices.Equal(current.modified, modified) {
+		return false, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(files[0], files[1])
+	if err != nil {
+		return
+	}
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{certificate},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	clientAuth := viper.GetString("server.tls.client_auth")
+	switch {
+	case clientAuth == tlsClientAuthNone:
+	case clientAuth != tlsClientAuthOptional && clientAuth != tlsClientAuthRequire:
+		return false, errTLSClientAuth
+	case files[2] == "" && clientAuth == tlsClientAuthRequire:
+		return false, errTLSNoClientCA
+	case files[2] != "":
+		pem, errRead := os.ReadFile(files[2])
+		if errRead != nil {
+			return false, errRead
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return false, errTLSClientCA
+		}
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if clientAuth == tlsClientAuthRequire {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	tlsCurrent.Store(&tlsState{config: config, modified: modified})
+	return true, nil
+}
+
+// startTLSReload reloads the certificate on SIGHUP and on changes of its files every `server.tls.reload`
+func startTLSReload() {
+	if interval := viper.GetDuration("server.tls.reload"); interval > 0 {
+		startPeriodicTask(interval, false, func() {
+			logTLSReload(reloadTLS(false))
+		})
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	waitGroup.Add(1)
+	go func() {
+		defer waitGroup.Done()
+		defer signal.Stop(hangup)
+
+		for {
+			select {
+			case <-hangup:
+				logTLSReload(reloadTLS(true))
+			case <-terminator:
+				return
+			}
+		}
+	}()
+}
+
+func logTLSReload(reloaded bool, err error) {
+	if err != nil {
+		logger.Warnf("keep certificate, reload of TLS failed: %s", err)
+	} else if reloaded {
+		logger.Info("reload TLS certificate")
+	}
+}
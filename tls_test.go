@@ -0,0 +1,258 @@
+/*******************************************************************************
+ * Test: TLS
+ *
+ * @author     agent <agent@local>
+ * @date       2026-10-19
+ ******************************************************************************/
+
+package main
+
+import (
+	"Moodle_Maxima_Pool/controller"
+	"Moodle_Maxima_Pool/models"
+	"Moodle_Maxima_Pool/services"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	pair        tls.Certificate
+}
+
+// createTestCertificate issues a certificate signed by the parent or a self-signed CA if parent is nil
+func createTestCertificate(t *testing.T, commonName string, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"Example"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.certificate, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCertificate{certificate: certificate, key: key, pair: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}}
+}
+
+// write stores the certificate and its key as PEM files in dir
+func (c *testCertificate) write(t *testing.T, dir string, name string) (certFile string, keyFile string) {
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+
+	certFile, keyFile = path.Join(dir, name+".crt"), path.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.certificate.Raw}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return
+}
+
+func resetTLS(t *testing.T) {
+	t.Cleanup(func() {
+		for _, key := range []string{"server.tls.cert", "server.tls.key", "server.tls.client_ca", "server.tls.client_auth", "server.tls.require_api_key"} {
+			viper.Set(key, nil)
+		}
+		tlsCurrent.Store(nil)
+	})
+	viper.Set("server.tls.client_auth", tlsClientAuthOptional)
+}
+
+func Test_reloadTLS(t *testing.T) {
+	resetTLS(t)
+	dir := t.TempDir()
+	ca := createTestCertificate(t, "Example CA", nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := createTestCertificate(t, "first", ca).write(t, dir, "server")
+	viper.Set("server.tls.cert", certFile)
+	viper.Set("server.tls.key", keyFile)
+	viper.Set("server.tls.client_ca", caFile)
+
+	reloaded, err := reloadTLS(false)
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, tlsCurrent.Load().config.ClientAuth)
+
+	reloaded, err = reloadTLS(false)
+	require.NoError(t, err)
+	assert.False(t, reloaded, "unchanged files")
+
+	// A replaced certificate is loaded, an invalid one is not
+	createTestCertificate(t, "second", ca).write(t, dir, "server")
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+	reloaded, err = reloadTLS(false)
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	leaf, err := x509.ParseCertificate(tlsCurrent.Load().config.Certificates[0].Certificate[0])
+	require.NoError(t, err)
+	assert.Equal(t, "second", leaf.Subject.CommonName)
+
+	require.NoError(t, os.WriteFile(keyFile, []byte("invalid"), 0600))
+	_, err = reloadTLS(true)
+	assert.Error(t, err)
+	assert.Equal(t, leaf.Raw, tlsCurrent.Load().config.Certificates[0].Certificate[0])
+}
+
+func Test_reloadTLS_clientAuth(t *testing.T) {
+	resetTLS(t)
+	dir := t.TempDir()
+	ca := createTestCertificate(t, "Example CA", nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := createTestCertificate(t, "server", ca).write(t, dir, "server")
+	invalidCA := path.Join(dir, "invalid.crt")
+	require.NoError(t, os.WriteFile(invalidCA, []byte("invalid"), 0600))
+	viper.Set("server.tls.cert", certFile)
+	viper.Set("server.tls.key", keyFile)
+
+	tests := []struct {
+		name       string
+		clientAuth string
+		clientCA   string
+		want       tls.ClientAuthType
+		wantErr    error
+	}{
+		{"none", tlsClientAuthNone, caFile, tls.NoClientCert, nil},
+		{"optional without CA", tlsClientAuthOptional, "", tls.NoClientCert, nil},
+		{"optional", tlsClientAuthOptional, caFile, tls.VerifyClientCertIfGiven, nil},
+		{"require", tlsClientAuthRequire, caFile, tls.RequireAndVerifyClientCert, nil},
+		{"require without CA", tlsClientAuthRequire, "", 0, errTLSNoClientCA},
+		{"invalid CA", tlsClientAuthOptional, invalidCA, 0, errTLSClientCA},
+		{"unknown", "maybe", caFile, 0, errTLSClientAuth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsCurrent.Store(nil)
+			viper.Set("server.tls.client_auth", tt.clientAuth)
+			viper.Set("server.tls.client_ca", tt.clientCA)
+
+			_, err := reloadTLS(true)
+			assert.Equal(t, tt.wantErr, err)
+			if tt.wantErr == nil {
+				assert.Equal(t, tt.want, tlsCurrent.Load().config.ClientAuth)
+			}
+		})
+	}
+}
+
+func Test_validateAPIKey_certificate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	resetTLS(t)
+	dir := t.TempDir()
+	ca := createTestCertificate(t, "Example CA", nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := createTestCertificate(t, "server", ca).write(t, dir, "server")
+	viper.Set("server.tls.cert", certFile)
+	viper.Set("server.tls.key", keyFile)
+	viper.Set("server.tls.client_ca", caFile)
+
+	store := `clients:
+  - name: moodle
+    key: "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+    subject: moodle.example.org
+    scopes: [job]
+  - name: other
+    key: "sha256:d9298a10d1b0735837dc4bd85dac641b0f3cef27a47e5d53a54f2f3f5b2fcffa"
+    scopes: [job]
+  - name: batch
+    subject: "CN=batch.example.org,O=Example"
+    scopes: [job]
+`
+	viper.Set("server.keys_file", path.Join(dir, "keys.yaml"))
+	require.NoError(t, os.WriteFile(viper.GetString("server.keys_file"), []byte(store), 0600))
+	require.NoError(t, services.ClientLoad())
+	defer func() {
+		viper.Set("server.keys_file", nil)
+		_ = services.ClientLoad()
+	}()
+
+	engine := gin.New()
+	engine.GET("/", validateAPIKey(models.ClientScopeJob), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(controller.ContextClient))
+	})
+	server := httptest.NewUnstartedServer(engine)
+	var err error
+	server.TLS, err = newTLSConfig()
+	require.NoError(t, err)
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.certificate)
+
+	tests := []struct {
+		name          string
+		commonName    string
+		key           string
+		requireAPIKey bool
+		wantStatus    int
+		wantClient    string
+	}{
+		{"common name", "moodle.example.org", "", false, http.StatusOK, "moodle"},
+		{"distinguished name without key", "batch.example.org", "", false, http.StatusOK, "batch"},
+		{"unknown subject", "unknown.example.org", "", false, http.StatusUnauthorized, ""},
+		{"key without certificate", "", "test", false, http.StatusOK, "moodle"},
+		{"key and certificate", "moodle.example.org", "test", true, http.StatusOK, "moodle"},
+		{"certificate without key", "moodle.example.org", "", true, http.StatusUnauthorized, ""},
+		{"key without certificate but required", "", "test", true, http.StatusUnauthorized, ""},
+		{"key of another client", "moodle.example.org", "other", true, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("server.tls.require_api_key", tt.requireAPIKey)
+
+			config := &tls.Config{RootCAs: roots}
+			if tt.commonName != "" {
+				config.Certificates = []tls.Certificate{createTestCertificate(t, tt.commonName, ca).pair}
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+			request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			require.NoError(t, err)
+			if tt.key != "" {
+				request.Header.Set("X-API-Key", tt.key)
+			}
+
+			resp, err := client.Do(request)
+			require.NoError(t, err)
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			if tt.wantClient != "" {
+				body := make([]byte, 64)
+				n, _ := resp.Body.Read(body)
+				assert.Equal(t, tt.wantClient, string(body[:n]))
+			}
+		})
+	}
+}